@@ -35,6 +35,12 @@ type ConstraintGetter func(string) ArchConstraint
 // parameters.
 type CharmResolver func(charm string, series string, channel string, arch string) (string, int, error)
 
+// UnitRemovalPolicy orders the units deployed for an application by their
+// preference for removal, the units to remove first coming first. It is used
+// when pruning to select the units to remove from an application that has
+// more units in the model than the bundle asks for.
+type UnitRemovalPolicy func(model *Model, appName string, application *charm.ApplicationSpec) []Unit
+
 // ChangesConfig is used to provide the required data for determining changes.
 type ChangesConfig struct {
 	Bundle           *charm.BundleData
@@ -44,6 +50,32 @@ type ChangesConfig struct {
 	ConstraintGetter ConstraintGetter
 	CharmResolver    CharmResolver
 	Force            bool
+	// Prune treats the bundle as the source of truth for the model. It
+	// implies all the options below: Unexpose, PruneApplications,
+	// PruneUnits, PruneRelations, PruneOffers and PruneMachines.
+	Prune bool
+	// Unexpose unexposes the applications and endpoints that the bundle
+	// does not expose.
+	Unexpose bool
+	// PruneApplications removes the applications in the model but not in
+	// the bundle, with their offers and relations.
+	PruneApplications bool
+	// PruneUnits removes the units of the applications that have more
+	// units in the model than the bundle asks for.
+	PruneUnits bool
+	// PruneRelations removes the relations in the model that the bundle
+	// does not declare.
+	PruneRelations bool
+	// PruneOffers removes the offers in the model that the bundle does not
+	// declare, and revokes the offer access not listed in the bundle.
+	PruneOffers bool
+	// PruneMachines removes the machines left without units once the
+	// units and applications are removed, unless they are mapped to
+	// bundle machines.
+	PruneMachines bool
+	// UnitRemovalPolicy selects the units to remove when pruning. If not
+	// set, HighestUnitsFirst is used.
+	UnitRemovalPolicy UnitRemovalPolicy
 	// TODO: add charm metadata for validation.
 }
 
@@ -72,18 +104,28 @@ func FromData(config ChangesConfig) ([]Change, error) {
 			ConstraintGetter: config.ConstraintGetter,
 		}
 	}
+	if err := model.validateSpaces(config.Bundle); err != nil {
+		return nil, errors.Trace(err)
+	}
 	model.initializeSequence()
 	model.InferMachineMap(config.Bundle)
 	changes := &changeset{}
 	resolver := resolver{
-		bundle:           config.Bundle,
-		model:            model,
-		bundleURL:        config.BundleURL,
-		logger:           config.Logger,
-		constraintGetter: config.ConstraintGetter,
-		charmResolver:    config.CharmResolver,
-		changes:          changes,
-		force:            config.Force,
+		bundle:            config.Bundle,
+		model:             model,
+		bundleURL:         config.BundleURL,
+		logger:            config.Logger,
+		constraintGetter:  config.ConstraintGetter,
+		charmResolver:     config.CharmResolver,
+		changes:           changes,
+		force:             config.Force,
+		unexpose:          config.Prune || config.Unexpose,
+		pruneApplications: config.Prune || config.PruneApplications,
+		pruneUnits:        config.Prune || config.PruneUnits,
+		pruneRelations:    config.Prune || config.PruneRelations,
+		pruneOffers:       config.Prune || config.PruneOffers,
+		pruneMachines:     config.Prune || config.PruneMachines,
+		unitRemovalPolicy: config.UnitRemovalPolicy,
 	}
 	addedApplications, err := resolver.handleApplications()
 	if err != nil {
@@ -107,7 +149,35 @@ func FromData(config ChangesConfig) ([]Change, error) {
 			return nil, errors.Trace(err)
 		}
 	}
-	return changes.sorted(), nil
+	if err := resolver.checkDyingEntities(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	var removedUnits map[string]string
+	if resolver.pruneUnits && resolver.bundle.Type != kubernetes {
+		if removedUnits, err = resolver.handleRemovedUnits(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	var removedRelations map[string][]string
+	if resolver.pruneRelations || resolver.pruneApplications {
+		removedRelations = resolver.handleRemovedRelations()
+	}
+	var removedOffers map[string][]string
+	if resolver.pruneOffers || resolver.pruneApplications {
+		removedOffers = resolver.handleRemovedOffers()
+	}
+	var removedApplications map[string]string
+	if resolver.pruneApplications {
+		removedApplications = resolver.handleRemovedApplications(removedRelations, removedOffers)
+	}
+	if resolver.pruneMachines && resolver.bundle.Type != kubernetes {
+		resolver.handleRemovedMachines(removedApplications, removedUnits)
+	}
+	sorted, err := changes.sorted()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return sorted, nil
 }
 
 // alreadyDeployedApplicationsFromBundle returns a set consisting of the
@@ -306,6 +376,17 @@ func (ch *UpgradeCharmChange) Args() (map[string]interface{}, error) {
 
 // Description implements Change.
 func (ch *UpgradeCharmChange) Description() []string {
+	if ch.Params.resourcesOnly {
+		var resources []string
+		for name := range ch.Params.Resources {
+			resources = append(resources, name)
+		}
+		for name := range ch.Params.LocalResources {
+			resources = append(resources, name)
+		}
+		sort.Strings(resources)
+		return []string{fmt.Sprintf("upgrade %s resources %s", ch.Params.Application, strings.Join(resources, ", "))}
+	}
 	var series string
 	if ch.Params.Series != "" {
 		series = " for series " + ch.Params.Series
@@ -347,7 +428,8 @@ type UpgradeCharmParams struct {
 	// Channel holds the preferred channel for obtaining the charm.
 	Channel string `json:"channel,omitempty"`
 
-	charmURL string
+	charmURL      string
+	resourcesOnly bool
 }
 
 // newAddMachineChange creates a new change for adding a machine or container.
@@ -622,6 +704,9 @@ type AddApplicationParams struct {
 	LocalResources map[string]string `json:"local-resources,omitempty"`
 	// Channel holds the channel of the application to be deployed.
 	Channel string `json:"channel,omitempty"`
+	// Trust holds whether the application is granted access to the
+	// cloud credentials of the model.
+	Trust bool `json:"trust,omitempty"`
 
 	// The public Charm holds either the charmURL of a placeholder for the
 	// add charm change.
@@ -874,6 +959,76 @@ func equalStringSlices(a, b []string) bool {
 	return setA.Difference(setB).IsEmpty()
 }
 
+// newUnexposeChange creates a new change for unexposing an application.
+func newUnexposeChange(params UnexposeParams, requires ...string) *UnexposeChange {
+	return &UnexposeChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "unexpose",
+		},
+		Params: params,
+	}
+}
+
+// UnexposeChange holds a change for unexposing an application, or some of
+// its endpoints.
+type UnexposeChange struct {
+	changeInfo
+	// Params holds parameters for unexposing an application.
+	Params UnexposeParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *UnexposeChange) GUIArgs() []interface{} {
+	if len(ch.Params.ExposedEndpoints) == 0 {
+		return []interface{}{ch.Params.Application, nil}
+	}
+	return []interface{}{ch.Params.Application, ch.Params.ExposedEndpoints}
+}
+
+// Args implements Change.Args.
+func (ch *UnexposeChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *UnexposeChange) Description() []string {
+	if len(ch.Params.ExposedEndpoints) == 0 {
+		return []string{fmt.Sprintf("unexpose %s", ch.Params.Application)}
+	}
+
+	var (
+		output        []string
+		endpointNames []string
+	)
+	for _, epName := range ch.Params.ExposedEndpoints {
+		if epName == "" {
+			output = append(output, fmt.Sprintf("remove expose settings for all endpoints of %s", ch.Params.Application))
+			continue
+		}
+		endpointNames = append(endpointNames, epName)
+	}
+	if len(endpointNames) != 0 {
+		plural := ""
+		if len(endpointNames) > 1 {
+			plural = "s"
+		}
+		output = append(output, fmt.Sprintf("remove expose settings for endpoint%s %s of %s", plural, strings.Join(endpointNames, ","), ch.Params.Application))
+	}
+	return output
+}
+
+// UnexposeParams holds parameters for unexposing an application.
+type UnexposeParams struct {
+	// Application holds the name of the application that must be unexposed.
+	Application string `json:"application"`
+
+	// ExposedEndpoints holds the endpoints whose expose settings are to be
+	// removed. An empty value indicates that the whole application should
+	// be unexposed.
+	ExposedEndpoints []string `json:"exposed-endpoints,omitempty"`
+}
+
 // newScaleChange creates a new change for scaling a Kubernetes application.
 func newScaleChange(params ScaleParams, requires ...string) *ScaleChange {
 	return &ScaleChange{
@@ -1015,10 +1170,11 @@ type SetOptionsParams struct {
 }
 
 // newSetConstraintsChange creates a new change for setting application constraints.
-func newSetConstraintsChange(params SetConstraintsParams) *SetConstraintsChange {
+func newSetConstraintsChange(params SetConstraintsParams, requires ...string) *SetConstraintsChange {
 	return &SetConstraintsChange{
 		changeInfo: changeInfo{
-			method: "setConstraints",
+			requires: requires,
+			method:   "setConstraints",
 		},
 		Params: params,
 	}
@@ -1054,6 +1210,156 @@ type SetConstraintsParams struct {
 	Constraints string `json:"constraints,omitempty"`
 }
 
+// newAddStorageChange creates a new change for adding storage to an
+// application.
+func newAddStorageChange(params AddStorageParams, requires ...string) *AddStorageChange {
+	return &AddStorageChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "addStorage",
+		},
+		Params: params,
+	}
+}
+
+// AddStorageChange holds a change for adding storage to the units of an
+// existing application.
+type AddStorageChange struct {
+	changeInfo
+	// Params holds parameters for adding storage.
+	Params AddStorageParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *AddStorageChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Application, ch.Params.StorageName, ch.Params.Storage}
+}
+
+// Args implements Change.Args.
+func (ch *AddStorageChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *AddStorageChange) Description() []string {
+	return []string{fmt.Sprintf("add storage %s to %s using %q", ch.Params.StorageName, ch.Params.Application, ch.Params.Storage)}
+}
+
+// AddStorageParams holds parameters for adding storage to an application.
+type AddStorageParams struct {
+	// Application is the name of the application.
+	Application string `json:"application"`
+	// StorageName is the name of the store declared by the charm.
+	StorageName string `json:"storage-name"`
+	// Storage holds the storage directive, such as "ebs,10G,1".
+	Storage string `json:"storage"`
+}
+
+// newBindChange creates a new change for moving the endpoints of an
+// application to other spaces.
+func newBindChange(params BindParams, requires ...string) *BindChange {
+	return &BindChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "bind",
+		},
+		Params: params,
+	}
+}
+
+// BindChange holds a change for updating the endpoint bindings of an
+// existing application.
+type BindChange struct {
+	changeInfo
+	// Params holds parameters for binding endpoints.
+	Params BindParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *BindChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Application, ch.Params.EndpointBindings}
+}
+
+// Args implements Change.Args.
+func (ch *BindChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *BindChange) Description() []string {
+	endpoints := make([]string, 0, len(ch.Params.EndpointBindings))
+	for endpoint := range ch.Params.EndpointBindings {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	bindings := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		space := ch.Params.EndpointBindings[endpoint]
+		if endpoint == "" {
+			bindings[i] = fmt.Sprintf("default space %s", space)
+			continue
+		}
+		bindings[i] = fmt.Sprintf("%s=%s", endpoint, space)
+	}
+	return []string{fmt.Sprintf("bind endpoints of %s: %s", ch.Params.Application, strings.Join(bindings, ", "))}
+}
+
+// BindParams holds parameters for binding application endpoints to spaces.
+type BindParams struct {
+	// Application is the name of the application.
+	Application string `json:"application"`
+	// EndpointBindings maps the endpoints to move to their new spaces. The
+	// empty endpoint name stands for the default space of the application.
+	EndpointBindings map[string]string `json:"endpoint-bindings"`
+}
+
+// newSetTrustChange creates a new change for granting or revoking the
+// trust of an application.
+func newSetTrustChange(params SetTrustParams, requires ...string) *SetTrustChange {
+	return &SetTrustChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "setTrust",
+		},
+		Params: params,
+	}
+}
+
+// SetTrustChange holds a change for granting or revoking the trust of an
+// existing application.
+type SetTrustChange struct {
+	changeInfo
+	// Params holds parameters for setting the trust.
+	Params SetTrustParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *SetTrustChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Application, ch.Params.Trust}
+}
+
+// Args implements Change.Args.
+func (ch *SetTrustChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *SetTrustChange) Description() []string {
+	if ch.Params.Trust {
+		return []string{fmt.Sprintf("grant trust to %s", ch.Params.Application)}
+	}
+	return []string{fmt.Sprintf("revoke trust from %s", ch.Params.Application)}
+}
+
+// SetTrustParams holds parameters for setting the trust of an application.
+type SetTrustParams struct {
+	// Application is the name of the application.
+	Application string `json:"application"`
+	// Trust holds whether the application is trusted with the cloud
+	// credentials of the model.
+	Trust bool `json:"trust"`
+}
+
 // CreateOfferChange holds a change for creating a new application endpoint offer.
 type CreateOfferChange struct {
 	changeInfo
@@ -1200,6 +1506,257 @@ type GrantOfferAccessParams struct {
 	Offer string `json:"offer"`
 }
 
+// RevokeOfferAccessChange holds a change for revoking the access of a user
+// to an offer.
+type RevokeOfferAccessChange struct {
+	changeInfo
+	// Params holds the parameters for the revocation.
+	Params RevokeOfferAccessParams
+}
+
+func newRevokeOfferAccessChange(params RevokeOfferAccessParams, requires ...string) *RevokeOfferAccessChange {
+	return &RevokeOfferAccessChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "revokeOfferAccess",
+		},
+		Params: params,
+	}
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *RevokeOfferAccessChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.User, ch.Params.Access, ch.Params.Offer}
+}
+
+// Args implements Change.Args.
+func (ch *RevokeOfferAccessChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *RevokeOfferAccessChange) Description() []string {
+	return []string{fmt.Sprintf("revoke %s access to offer %s from user %s", ch.Params.Access, ch.Params.Offer, ch.Params.User)}
+}
+
+// RevokeOfferAccessParams holds the parameters for revoking the access of a
+// user. Revoking an access level leaves the user with the level below it,
+// so revoking "read" access removes all access.
+type RevokeOfferAccessParams struct {
+	// User holds the user name to revoke access from.
+	User string `json:"user"`
+	// The type of access to revoke.
+	Access string `json:"access"`
+	// The offer name to revoke access to.
+	Offer string `json:"offer"`
+}
+
+// RemoveOfferChange holds a change for removing an offer that is no
+// longer part of the bundle.
+type RemoveOfferChange struct {
+	changeInfo
+	// Params holds the parameters for removing the offer.
+	Params RemoveOfferParams
+}
+
+// newRemoveOfferChange creates a new change for removing an offer.
+func newRemoveOfferChange(params RemoveOfferParams, requires ...string) *RemoveOfferChange {
+	return &RemoveOfferChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "removeOffer",
+		},
+		Params: params,
+	}
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *RemoveOfferChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Application, ch.Params.OfferName}
+}
+
+// Args implements Change.Args.
+func (ch *RemoveOfferChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *RemoveOfferChange) Description() []string {
+	return []string{fmt.Sprintf("remove offer %s of %s", ch.Params.OfferName, ch.Params.Application)}
+}
+
+// RemoveOfferParams holds the parameters for removing an offer.
+type RemoveOfferParams struct {
+	// Application is the name of the offered application.
+	Application string `json:"application"`
+	// OfferName is the name of the offer to remove.
+	OfferName string `json:"offer-name"`
+}
+
+// newRemoveApplicationChange creates a new change for removing an application.
+func newRemoveApplicationChange(params RemoveApplicationParams, requires ...string) *RemoveApplicationChange {
+	return &RemoveApplicationChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "removeApplication",
+		},
+		Params: params,
+	}
+}
+
+// RemoveApplicationChange holds a change for removing an application that
+// is deployed in the model but no longer part of the bundle.
+type RemoveApplicationChange struct {
+	changeInfo
+	// Params holds parameters for removing an application.
+	Params RemoveApplicationParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *RemoveApplicationChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Application}
+}
+
+// Args implements Change.Args.
+func (ch *RemoveApplicationChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *RemoveApplicationChange) Description() []string {
+	return []string{fmt.Sprintf("remove application %s", ch.Params.Application)}
+}
+
+// RemoveApplicationParams holds parameters for removing an application.
+type RemoveApplicationParams struct {
+	// Application is the name of the application to be removed.
+	Application string `json:"application"`
+}
+
+// newRemoveUnitChange creates a new change for removing an application unit.
+func newRemoveUnitChange(params RemoveUnitParams, requires ...string) *RemoveUnitChange {
+	return &RemoveUnitChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "removeUnit",
+		},
+		Params: params,
+	}
+}
+
+// RemoveUnitChange holds a change for removing an application unit.
+type RemoveUnitChange struct {
+	changeInfo
+	// Params holds parameters for removing a unit.
+	Params RemoveUnitParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *RemoveUnitChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Unit}
+}
+
+// Args implements Change.Args.
+func (ch *RemoveUnitChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *RemoveUnitChange) Description() []string {
+	return []string{fmt.Sprintf("remove unit %s", ch.Params.Unit)}
+}
+
+// RemoveUnitParams holds parameters for removing an application unit.
+type RemoveUnitParams struct {
+	// Unit is the name of the unit to be removed.
+	Unit string `json:"unit"`
+}
+
+// newRemoveMachineChange creates a new change for removing a machine or
+// container.
+func newRemoveMachineChange(params RemoveMachineParams, requires ...string) *RemoveMachineChange {
+	return &RemoveMachineChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "removeMachines",
+		},
+		Params: params,
+	}
+}
+
+// RemoveMachineChange holds a change for removing a machine or container
+// that hosts no units.
+type RemoveMachineChange struct {
+	changeInfo
+	// Params holds parameters for removing a machine.
+	Params RemoveMachineParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *RemoveMachineChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Machine}
+}
+
+// Args implements Change.Args.
+func (ch *RemoveMachineChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *RemoveMachineChange) Description() []string {
+	return []string{fmt.Sprintf("remove machine %s", ch.Params.Machine)}
+}
+
+// RemoveMachineParams holds parameters for removing a machine or container.
+type RemoveMachineParams struct {
+	// Machine is the id of the machine or container to be removed.
+	Machine string `json:"machine"`
+}
+
+// newRemoveRelationChange creates a new change for removing a relation.
+func newRemoveRelationChange(params RemoveRelationParams, requires ...string) *RemoveRelationChange {
+	return &RemoveRelationChange{
+		changeInfo: changeInfo{
+			requires: requires,
+			method:   "removeRelation",
+		},
+		Params: params,
+	}
+}
+
+// RemoveRelationChange holds a change for removing a relation between two
+// applications.
+type RemoveRelationChange struct {
+	changeInfo
+	// Params holds parameters for removing a relation.
+	Params RemoveRelationParams
+}
+
+// GUIArgs implements Change.GUIArgs.
+func (ch *RemoveRelationChange) GUIArgs() []interface{} {
+	return []interface{}{ch.Params.Endpoint1, ch.Params.Endpoint2}
+}
+
+// Args implements Change.Args.
+func (ch *RemoveRelationChange) Args() (map[string]interface{}, error) {
+	return paramsToArgs(ch.Params)
+}
+
+// Description implements Change.
+func (ch *RemoveRelationChange) Description() []string {
+	return []string{fmt.Sprintf("remove relation %s - %s", ch.Params.Endpoint1, ch.Params.Endpoint2)}
+}
+
+// RemoveRelationParams holds parameters for removing a relation between two
+// applications.
+type RemoveRelationParams struct {
+	// Endpoint1 and Endpoint2 hold the relation endpoints in the
+	// "application:relation" form. The endpoints are in canonical order,
+	// so the same relation always produces the same parameters.
+	Endpoint1 string `json:"endpoint1"`
+	Endpoint2 string `json:"endpoint2"`
+}
+
 // changeset holds the list of changes returned by FromData.
 type changeset struct {
 	changes []Change
@@ -1225,30 +1782,122 @@ func (cs *changeset) dependents() map[string][]string {
 	return result
 }
 
-// sorted returns the changes sorted by requirements, required first.
-func (cs *changeset) sorted() []Change {
-	done := set.NewStrings()
-	var sorted []Change
-	changes := cs.changes[:]
-mainloop:
-	for len(changes) != 0 {
-		// Note that all valid bundles have at least two changes
-		// (add one charm and deploy one application).
-		change := changes[0]
-		changes = changes[1:]
+// sorted returns the changes sorted by requirements, required first. The
+// changes are emitted in passes over the list: each pass emits in order the
+// changes whose requirements are emitted, and leaves the others to the next
+// pass. Rather than iterating over the passes, the pass of each change is
+// computed from the passes of its requirements, in dependency order, so
+// that sorting takes linear time.
+func (cs *changeset) sorted() ([]Change, error) {
+	index := make(map[string]int, len(cs.changes))
+	for i, change := range cs.changes {
+		index[change.Id()] = i
+	}
+	// pending holds the number of requirements of each change that are not
+	// visited yet, and dependents the changes requiring each change.
+	pending := make([]int, len(cs.changes))
+	dependents := make([][]int, len(cs.changes))
+	for i, change := range cs.changes {
 		for _, r := range change.Requires() {
-			if !done.Contains(r) {
+			j, found := index[r]
+			if !found {
+				return nil, &UnknownRequirementError{Change: change.Id(), Requirement: r}
+			}
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	pass := make([]int, len(cs.changes))
+	var queue []int
+	for i := range cs.changes {
+		if pending[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	lastPass, visited := 0, 0
+	for len(queue) != 0 {
+		j := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, i := range dependents[j] {
+			// A change listed before one of its requirements is emitted
+			// in the pass following the requirement.
+			p := pass[j]
+			if i < j {
+				p++
+			}
+			if p > pass[i] {
+				pass[i] = p
+			}
+			if p > lastPass {
+				lastPass = p
+			}
+			if pending[i]--; pending[i] == 0 {
+				queue = append(queue, i)
+			}
+		}
+	}
+	if visited != len(cs.changes) {
+		return nil, cs.cycleError(index, pending)
+	}
 
-				// This change requires a change which is not yet listed.
-				// Push this change at the end of the list and retry later.
-				changes = append(changes, change)
-				continue mainloop
+	passes := make([][]Change, lastPass+1)
+	for i, change := range cs.changes {
+		passes[pass[i]] = append(passes[pass[i]], change)
+	}
+	sorted := make([]Change, 0, len(cs.changes))
+	for _, changes := range passes {
+		sorted = append(sorted, changes...)
+	}
+	return sorted, nil
+}
+
+// cycleError returns the error describing a dependency cycle among the
+// changes with pending requirements. Each of these changes requires
+// another one, so following the requirements leads to a cycle.
+func (cs *changeset) cycleError(index map[string]int, pending []int) error {
+	i := 0
+	for pending[i] == 0 {
+		i++
+	}
+	position := make(map[int]int)
+	var path []string
+	for {
+		if start, found := position[i]; found {
+			return &DependencyCycleError{Cycle: append(path[start:], cs.changes[i].Id())}
+		}
+		position[i] = len(path)
+		path = append(path, cs.changes[i].Id())
+		for _, r := range cs.changes[i].Requires() {
+			if j := index[r]; pending[j] != 0 {
+				i = j
+				break
 			}
 		}
-		done.Add(change.Id())
-		sorted = append(sorted, change)
 	}
-	return sorted
+}
+
+// UnknownRequirementError indicates that a change requires a change which
+// is not part of the plan.
+type UnknownRequirementError struct {
+	Change      string
+	Requirement string
+}
+
+func (err *UnknownRequirementError) Error() string {
+	return fmt.Sprintf("change %q requires unknown change %q", err.Change, err.Requirement)
+}
+
+// DependencyCycleError indicates that changes require each other. Each
+// change of the cycle requires the next one, and the last change is the
+// first one.
+type DependencyCycleError struct {
+	Cycle []string
+}
+
+func (err *DependencyCycleError) Error() string {
+	return fmt.Sprintf("dependency cycle between changes: %s", strings.Join(err.Cycle, " -> "))
 }
 
 func storeLocation(schema string) string {
@@ -0,0 +1,130 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/juju/collections/set"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type changesetSuite struct{}
+
+var _ = gc.Suite(&changesetSuite{})
+
+// newChangeset returns a changeset of machine changes, each change
+// requiring the changes at the given indexes.
+func newChangeset(requires [][]int) *changeset {
+	cs := &changeset{}
+	for _, indexes := range requires {
+		var ids []string
+		for _, i := range indexes {
+			ids = append(ids, fmt.Sprintf("addMachines-%d", i))
+		}
+		cs.add(newAddMachineChange(AddMachineParams{}, ids...))
+	}
+	return cs
+}
+
+// queueSorted sorts the changes the way changesets used to, pushing the
+// changes with missing requirements back to the end of the queue.
+func queueSorted(cs *changeset) []Change {
+	done := set.NewStrings()
+	var sorted []Change
+	changes := cs.changes[:]
+mainloop:
+	for len(changes) != 0 {
+		change := changes[0]
+		changes = changes[1:]
+		for _, r := range change.Requires() {
+			if !done.Contains(r) {
+				changes = append(changes, change)
+				continue mainloop
+			}
+		}
+		done.Add(change.Id())
+		sorted = append(sorted, change)
+	}
+	return sorted
+}
+
+func changeIds(changes []Change) []string {
+	ids := make([]string, len(changes))
+	for i, change := range changes {
+		ids[i] = change.Id()
+	}
+	return ids
+}
+
+func (*changesetSuite) TestSorted(c *gc.C) {
+	cs := newChangeset([][]int{
+		{3},
+		{},
+		{0, 1},
+		{1},
+		{2},
+	})
+	sorted, err := cs.sorted()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(changeIds(sorted), jc.DeepEquals, []string{
+		"addMachines-1", "addMachines-3", "addMachines-0", "addMachines-2", "addMachines-4",
+	})
+}
+
+func (*changesetSuite) TestSortedMatchesQueueOrder(c *gc.C) {
+	r := rand.New(rand.NewSource(42))
+	for n := 0; n < 200; n++ {
+		size := 1 + r.Intn(30)
+		// Changes only require changes that come before them in a random
+		// order, so that there are no cycles.
+		order := r.Perm(size)
+		requires := make([][]int, size)
+		for k, i := range order {
+			for _, j := range order[:k] {
+				if r.Intn(4) == 0 {
+					requires[i] = append(requires[i], j)
+				}
+			}
+		}
+		cs := newChangeset(requires)
+		sorted, err := cs.sorted()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(changeIds(sorted), jc.DeepEquals, changeIds(queueSorted(cs)), gc.Commentf("requires: %v", requires))
+	}
+}
+
+func (*changesetSuite) TestSortedUnknownRequirement(c *gc.C) {
+	cs := newChangeset([][]int{{}, {0}})
+	cs.add(newAddMachineChange(AddMachineParams{}, "addCharm-7"))
+	_, err := cs.sorted()
+	c.Assert(err, gc.ErrorMatches, `change "addMachines-2" requires unknown change "addCharm-7"`)
+	c.Assert(err, jc.DeepEquals, &UnknownRequirementError{
+		Change:      "addMachines-2",
+		Requirement: "addCharm-7",
+	})
+}
+
+func (*changesetSuite) TestSortedCycle(c *gc.C) {
+	cs := newChangeset([][]int{
+		{},
+		{0, 4},
+		{1},
+		{},
+		{2, 3},
+	})
+	_, err := cs.sorted()
+	c.Assert(err, gc.ErrorMatches, `dependency cycle between changes: addMachines-1 -> addMachines-4 -> addMachines-2 -> addMachines-1`)
+	c.Assert(err, jc.DeepEquals, &DependencyCycleError{
+		Cycle: []string{"addMachines-1", "addMachines-4", "addMachines-2", "addMachines-1"},
+	})
+}
+
+func (*changesetSuite) TestSortedSelfRequirement(c *gc.C) {
+	cs := newChangeset([][]int{{0}})
+	_, err := cs.sorted()
+	c.Assert(err, gc.ErrorMatches, `dependency cycle between changes: addMachines-0 -> addMachines-0`)
+}
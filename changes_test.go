@@ -3261,6 +3261,10 @@ func (s *changesSuite) assertParseData(c *gc.C, content string, expected []recor
 }
 
 func (s *changesSuite) assertParseDataWithModel(c *gc.C, model *bundlechanges.Model, content string, expected []record) {
+	s.assertParseDataWithConfig(c, bundlechanges.ChangesConfig{Model: model}, content, expected)
+}
+
+func (s *changesSuite) assertParseDataWithConfig(c *gc.C, config bundlechanges.ChangesConfig, content string, expected []record) {
 	// Retrieve and validate the bundle data merging any overlays in the bundle contents.
 	bundleSrc, err := charm.StreamBundleDataSource(strings.NewReader(content), "./")
 	c.Assert(err, jc.ErrorIsNil)
@@ -3270,11 +3274,9 @@ func (s *changesSuite) assertParseDataWithModel(c *gc.C, model *bundlechanges.Mo
 	c.Assert(err, jc.ErrorIsNil)
 
 	// Retrieve the changes, and convert them to a sequence of records.
-	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
-		Model:  model,
-		Bundle: data,
-		Logger: loggo.GetLogger("bundlechanges"),
-	})
+	config.Bundle = data
+	config.Logger = loggo.GetLogger("bundlechanges")
+	changes, err := bundlechanges.FromData(config)
 	c.Assert(err, jc.ErrorIsNil)
 	records := make([]record, len(changes))
 	for i, change := range changes {
@@ -3681,6 +3683,227 @@ applications:
 	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
 }
 
+func (s *changesSuite) TestPruneUnexposesApplication(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:   "cs:django-4",
+				Exposed: true,
+			},
+		},
+	}
+	s.checkBundleWithConfig(c, bundleContent, bundlechanges.ChangesConfig{
+		Model: existingModel,
+		Prune: true,
+	}, []string{"unexpose django"}, "")
+}
+
+func (s *changesSuite) prunedExposedEndpointsModel() *bundlechanges.Model {
+	return &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:   "cs:django-4",
+				Exposed: true,
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+					"": {
+						ExposeToCIDRs: []string{"0.0.0.0/0"},
+					},
+					"www": {
+						ExposeToCIDRs: []string{"13.37.0.0/16"},
+					},
+					"admin": {
+						ExposeToSpaces: []string{"public"},
+					},
+					"dmz": {
+						ExposeToSpaces: []string{"public"},
+					},
+				},
+			},
+		},
+	}
+}
+
+const prunedExposedEndpointsBundle = `
+applications:
+    django:
+      charm: cs:django-4
+--- #overlay
+applications:
+    django:
+      exposed-endpoints:
+        www:
+          expose-to-cidrs:
+            - 13.37.0.0/16
+            `
+
+func (s *changesSuite) TestPruneUnexposesEndpoints(c *gc.C) {
+	expectedChanges := []string{
+		"override expose settings for endpoint www of django and allow access from CIDR 13.37.0.0/16",
+		"remove expose settings for all endpoints of django",
+		"remove expose settings for endpoints admin,dmz of django",
+	}
+	s.checkBundleWithConfig(c, prunedExposedEndpointsBundle, bundlechanges.ChangesConfig{
+		Model: s.prunedExposedEndpointsModel(),
+		Prune: true,
+	}, expectedChanges, "")
+}
+
+func (s *changesSuite) TestUnexposeWithoutPrune(c *gc.C) {
+	expectedChanges := []string{
+		"override expose settings for endpoint www of django and allow access from CIDR 13.37.0.0/16",
+	}
+	s.checkBundleExistingModel(c, prunedExposedEndpointsBundle, s.prunedExposedEndpointsModel(), expectedChanges)
+}
+
+// partiallyPrunedModel returns a model with an exposed application and an
+// application that the bundles of the partial pruning tests don't declare.
+func (s *changesSuite) partiallyPrunedModel() *bundlechanges.Model {
+	return &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:   "cs:django-4",
+				Exposed: true,
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "1"},
+				},
+			},
+			"mysql": {
+				Charm:  "cs:mysql-58",
+				Offers: []string{"db"},
+				Units: []bundlechanges.Unit{
+					{Name: "mysql/0", Machine: "2"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+			"1": {ID: "1"},
+			"2": {ID: "2"},
+		},
+		Relations: []bundlechanges.Relation{{
+			App1: "django", Endpoint1: "db", App2: "mysql", Endpoint2: "db",
+		}},
+	}
+}
+
+const partiallyPrunedBundle = `
+applications:
+    django:
+        charm: cs:django-4
+        num_units: 1
+`
+
+func (s *changesSuite) TestUnexposeOnly(c *gc.C) {
+	s.checkBundleWithConfig(c, partiallyPrunedBundle, bundlechanges.ChangesConfig{
+		Model:    s.partiallyPrunedModel(),
+		Unexpose: true,
+	}, []string{"unexpose django"}, "")
+}
+
+func (s *changesSuite) TestPruneApplicationsOnly(c *gc.C) {
+	expectedChanges := []string{
+		"remove relation django:db - mysql:db",
+		"remove offer db of mysql",
+		"remove application mysql",
+	}
+	s.checkBundleWithConfig(c, partiallyPrunedBundle, bundlechanges.ChangesConfig{
+		Model:             s.partiallyPrunedModel(),
+		PruneApplications: true,
+	}, expectedChanges, "")
+}
+
+func (s *changesSuite) TestPruneUnitsAndMachines(c *gc.C) {
+	expectedChanges := []string{
+		"remove unit django/1",
+		"remove machine 1",
+	}
+	s.checkBundleWithConfig(c, partiallyPrunedBundle, bundlechanges.ChangesConfig{
+		Model:         s.partiallyPrunedModel(),
+		PruneUnits:    true,
+		PruneMachines: true,
+	}, expectedChanges, "")
+}
+
+func (s *changesSuite) TestPruneKeepsWildcardExposeWithoutEndpoints(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        expose: true
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:   "cs:django-4",
+				Exposed: true,
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+					"": {
+						ExposeToCIDRs: []string{"0.0.0.0/0", "::/0"},
+					},
+					"admin": {
+						ExposeToSpaces: []string{"public"},
+					},
+				},
+			},
+		},
+	}
+	expectedChanges := []string{
+		"expose all endpoints of django and allow access from CIDRs 0.0.0.0/0 and ::/0",
+		"remove expose settings for endpoint admin of django",
+	}
+	s.checkBundleWithConfig(c, bundleContent, bundlechanges.ChangesConfig{
+		Model: existingModel,
+		Prune: true,
+	}, expectedChanges, "")
+}
+
+func (s *changesSuite) TestUnexposeChangeArgs(c *gc.C) {
+	expected := []record{{
+		Id:     "expose-0",
+		Method: "expose",
+		Params: bundlechanges.ExposeParams{
+			Application: "django",
+			ExposedEndpoints: map[string]*bundlechanges.ExposedEndpointParams{
+				"www": {ExposeToCIDRs: []string{"13.37.0.0/16"}},
+			},
+		},
+		GUIArgs: []interface{}{"django", map[string]*bundlechanges.ExposedEndpointParams{
+			"www": {ExposeToCIDRs: []string{"13.37.0.0/16"}},
+		}},
+		Args: map[string]interface{}{
+			"application": "django",
+			"exposed-endpoints": map[string]interface{}{
+				"www": map[string]interface{}{
+					"expose-to-cidrs": []interface{}{"13.37.0.0/16"},
+				},
+			},
+		},
+	}, {
+		Id:       "unexpose-1",
+		Requires: []string{"expose-0"},
+		Method:   "unexpose",
+		Params: bundlechanges.UnexposeParams{
+			Application:      "django",
+			ExposedEndpoints: []string{"", "admin", "dmz"},
+		},
+		GUIArgs: []interface{}{"django", []string{"", "admin", "dmz"}},
+		Args: map[string]interface{}{
+			"application":       "django",
+			"exposed-endpoints": []interface{}{"", "admin", "dmz"},
+		},
+	}}
+	s.assertParseDataWithConfig(c, bundlechanges.ChangesConfig{
+		Model:    s.prunedExposedEndpointsModel(),
+		Unexpose: true,
+	}, prunedExposedEndpointsBundle, expected)
+}
+
 func (s *changesSuite) TestCharmUpgrade(c *gc.C) {
 	bundleContent := `
                 applications:
@@ -5424,58 +5647,1502 @@ func (s *changesSuite) TestNoPossibleTargets(c *gc.C) {
 	s.checkBundleImpl(c, bundleContent, existingModel, nil, `bundle and machine mapping are inconsistent: need an explicit entry mapping bundle machine "0" - the target should host \[memcached\]`, nil, nil)
 }
 
-func (s *changesSuite) checkBundle(c *gc.C, bundleContent string, expectedChanges []string) {
-	s.checkBundleImpl(c, bundleContent, nil, expectedChanges, "", nil, nil)
+func (s *changesSuite) TestPruneApplications(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 1
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+				},
+			},
+			"mysql": {
+				Charm: "cs:mysql-2",
+				Units: []bundlechanges.Unit{
+					{Name: "mysql/0", Machine: "1"},
+				},
+			},
+			"memcached": {
+				Charm: "cs:memcached-1",
+			},
+		},
+	}
+	expectedChanges := []string{
+		"remove application memcached",
+		"remove application mysql",
+	}
+	s.checkBundleWithConfig(c, bundleContent, bundlechanges.ChangesConfig{
+		Model: existingModel,
+		Prune: true,
+	}, expectedChanges, "")
 }
 
-func (s *changesSuite) checkBundleExistingModel(c *gc.C, bundleContent string, existingModel *bundlechanges.Model, expectedChanges []string) {
-	s.checkBundleImpl(c, bundleContent, existingModel, expectedChanges, "", nil, nil)
+func (s *changesSuite) TestPruneDisabledKeepsApplications(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+			},
+			"mysql": {
+				Charm: "cs:mysql-2",
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
 }
 
-func (s *changesSuite) checkBundleError(c *gc.C, bundleContent string, errMatch string) {
-	s.checkBundleImpl(c, bundleContent, nil, nil, errMatch, nil, nil)
+func (s *changesSuite) TestPruneRelations(c *gc.C) {
+	bundleContent := `
+                applications:
+                    mysql:
+                        charm: cs:mysql-2
+                    wordpress:
+                        charm: cs:wordpress-3
+                relations:
+                    - - wordpress:db
+                      - mysql:server
+                    - - wordpress
+                      - mysql:juju-info
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"memcached": {Charm: "cs:memcached-1"},
+			"mysql":     {Charm: "cs:mysql-2"},
+			"wordpress": {Charm: "cs:wordpress-3"},
+		},
+		Relations: []bundlechanges.Relation{{
+			App1: "mysql", Endpoint1: "server",
+			App2: "wordpress", Endpoint2: "db",
+		}, {
+			App1: "wordpress", Endpoint1: "juju-info",
+			App2: "mysql", Endpoint2: "juju-info",
+		}, {
+			App1: "wordpress", Endpoint1: "cache",
+			App2: "memcached", Endpoint2: "cache",
+		}, {
+			App1: "wordpress", Endpoint1: "monitoring",
+			App2: "mysql", Endpoint2: "monitoring",
+		}, {
+			// Peer relations are never removed.
+			App1: "mysql", Endpoint1: "cluster",
+			App2: "mysql", Endpoint2: "cluster",
+		}},
+	}
+	expectedChanges := []string{
+		"add relation wordpress - mysql:juju-info",
+		"remove relation memcached:cache - wordpress:cache",
+		"remove relation mysql:monitoring - wordpress:monitoring",
+		"remove application memcached",
+	}
+	s.checkBundleWithConfig(c, bundleContent, bundlechanges.ChangesConfig{
+		Model: existingModel,
+		Prune: true,
+	}, expectedChanges, "")
 }
 
-func (s *changesSuite) checkBundleWithConstraintsParser(c *gc.C, bundleContent string, expectedChanges []string, parserFn bundlechanges.ConstraintGetter) {
-	s.checkBundleImpl(c, bundleContent, nil, expectedChanges, "", parserFn, nil)
+func (s *changesSuite) TestPruneRelationsOrderedBeforeApplications(c *gc.C) {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        applications:
+            wordpress:
+                charm: cs:wordpress-3
+    `))
+	c.Assert(err, jc.ErrorIsNil)
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model: &bundlechanges.Model{
+			Applications: map[string]*bundlechanges.Application{
+				"mysql":     {Charm: "cs:mysql-2"},
+				"wordpress": {Charm: "cs:wordpress-3"},
+			},
+			Relations: []bundlechanges.Relation{{
+				App1: "wordpress", Endpoint1: "db",
+				App2: "mysql", Endpoint2: "server",
+			}},
+		},
+		Logger: loggo.GetLogger("bundlechanges"),
+		Prune:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(changes, gc.HasLen, 2)
+
+	relation, ok := changes[0].(*bundlechanges.RemoveRelationChange)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(relation.Id(), gc.Equals, "removeRelation-0")
+	c.Check(relation.Method(), gc.Equals, "removeRelation")
+	c.Check(relation.GUIArgs(), jc.DeepEquals, []interface{}{"mysql:server", "wordpress:db"})
+	args, err := relation.Args()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(args, jc.DeepEquals, map[string]interface{}{
+		"endpoint1": "mysql:server",
+		"endpoint2": "wordpress:db",
+	})
+
+	application, ok := changes[1].(*bundlechanges.RemoveApplicationChange)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(application.Requires(), jc.DeepEquals, []string{"removeRelation-0"})
 }
 
-func (s *changesSuite) checkBundleExistingModelWithConstraintsParser(c *gc.C, bundleContent string, existingModel *bundlechanges.Model, expectedChanges []string, parserFn bundlechanges.ConstraintGetter) {
-	s.checkBundleImpl(c, bundleContent, existingModel, expectedChanges, "", parserFn, nil)
+func (s *changesSuite) scaledDownModel() *bundlechanges.Model {
+	return &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "1"},
+					{Name: "django/2", Machine: "2"},
+					{Name: "django/3", Machine: "3/lxd/0"},
+				},
+			},
+			"memcached": {
+				Charm: "cs:memcached-1",
+				Units: []bundlechanges.Unit{
+					{Name: "memcached/0", Machine: "2"},
+					{Name: "memcached/1", Machine: "3"},
+				},
+			},
+			"logging": {
+				Charm:         "cs:logging-1",
+				SubordinateTo: []string{"django"},
+				Units: []bundlechanges.Unit{
+					{Name: "logging/0", Machine: "0"},
+					{Name: "logging/1", Machine: "1"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0":       {ID: "0"},
+			"1":       {ID: "1"},
+			"2":       {ID: "2"},
+			"3":       {ID: "3"},
+			"3/lxd/0": {ID: "3/lxd/0"},
+		},
+	}
 }
 
-func (s *changesSuite) checkBundleWithConstraintsParserError(c *gc.C, bundleContent, errMatch string, parserFn bundlechanges.ConstraintGetter) {
-	s.checkBundleImpl(c, bundleContent, nil, nil, errMatch, parserFn, nil)
+const scaledDownBundle = `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 2
+                        to: ["2", "lxd:3"]
+                    memcached:
+                        charm: cs:memcached-1
+                        num_units: 2
+                        to: ["2", "3"]
+                    logging:
+                        charm: cs:logging-1
+                machines:
+                    "2":
+                    "3":
+            `
+
+func (s *changesSuite) TestPruneUnitsHighestFirst(c *gc.C) {
+	expectedChanges := []string{
+		"remove unit django/3",
+		"remove unit django/2",
+		"remove machine 3/lxd/0",
+	}
+	s.checkBundleWithConfig(c, scaledDownBundle, bundlechanges.ChangesConfig{
+		Model: s.scaledDownModel(),
+		Prune: true,
+	}, expectedChanges, "")
 }
 
-func (s *changesSuite) checkBundleExistingModelWithRevisionParser(c *gc.C, bundleContent string, existingModel *bundlechanges.Model, expectedChanges []string, charmResolverFn bundlechanges.CharmResolver) {
-	s.checkBundleImpl(c, bundleContent, existingModel, expectedChanges, "", nil, charmResolverFn)
+func (s *changesSuite) TestPruneUnitsEmptyMachinesFirst(c *gc.C) {
+	// The machines of django/1 and django/3 host no other units.
+	expectedChanges := []string{
+		"remove unit django/3",
+		"remove unit django/1",
+		"remove machine 3/lxd/0",
+		"remove machine 1",
+	}
+	s.checkBundleWithConfig(c, scaledDownBundle, bundlechanges.ChangesConfig{
+		Model:             s.scaledDownModel(),
+		Prune:             true,
+		UnitRemovalPolicy: bundlechanges.EmptyMachinesFirst,
+	}, expectedChanges, "")
 }
 
-func (s *changesSuite) checkBundleImpl(c *gc.C,
-	bundleContent string,
-	existingModel *bundlechanges.Model,
-	expectedChanges []string,
-	errMatch string,
-	parserFn bundlechanges.ConstraintGetter,
-	charmResolverFn bundlechanges.CharmResolver,
-) {
-	// Retrieve and validate the bundle data merging any overlays in the bundle contents.
-	bundleSrc, err := charm.StreamBundleDataSource(strings.NewReader(bundleContent), "./")
-	c.Assert(err, jc.ErrorIsNil)
-	data, err := charm.ReadAndMergeBundleData(bundleSrc)
-	c.Assert(err, jc.ErrorIsNil)
-	err = data.Verify(nil, nil, nil)
-	c.Assert(err, jc.ErrorIsNil)
+func (s *changesSuite) TestPruneUnitsUnplacedFirst(c *gc.C) {
+	// The units on machine 2 and in an lxd container on machine 3 satisfy
+	// the placement directives.
+	expectedChanges := []string{
+		"remove unit django/1",
+		"remove unit django/0",
+		"remove machine 0",
+		"remove machine 1",
+	}
+	s.checkBundleWithConfig(c, scaledDownBundle, bundlechanges.ChangesConfig{
+		Model:             s.scaledDownModel(),
+		Prune:             true,
+		UnitRemovalPolicy: bundlechanges.UnplacedUnitsFirst,
+	}, expectedChanges, "")
+}
 
-	// Retrieve the changes, and convert them to a sequence of records.
-	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
-		Bundle:           data,
+func (s *changesSuite) TestPruneUnitsPolicyError(c *gc.C) {
+	s.checkBundleWithConfig(c, scaledDownBundle, bundlechanges.ChangesConfig{
+		Model: s.scaledDownModel(),
+		Prune: true,
+		UnitRemovalPolicy: func(*bundlechanges.Model, string, *charm.ApplicationSpec) []bundlechanges.Unit {
+			return []bundlechanges.Unit{{Name: "django/0"}}
+		},
+	}, nil, `unit removal policy selected 1 units of django for removal, need 2`)
+}
+
+func (s *changesSuite) TestScaleDownWithoutPrune(c *gc.C) {
+	s.checkBundleExistingModel(c, scaledDownBundle, s.scaledDownModel(), []string{})
+}
+
+func (s *changesSuite) prunedMachinesModel() *bundlechanges.Model {
+	return &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "1/lxd/0"},
+				},
+			},
+			"mysql": {
+				Charm: "cs:mysql-2",
+				Units: []bundlechanges.Unit{
+					{Name: "mysql/0", Machine: "1"},
+					{Name: "mysql/1", Machine: "2"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0":       {ID: "0"},
+			"1":       {ID: "1"},
+			"1/lxd/0": {ID: "1/lxd/0"},
+			"2":       {ID: "2"},
+			"3":       {ID: "3"},
+		},
+	}
+}
+
+func (s *changesSuite) TestPruneMachines(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 1
+            `
+	changes, err := s.pruneChanges(c, bundleContent, s.prunedMachinesModel())
+	c.Assert(err, jc.ErrorIsNil)
+	var descriptions []string
+	requires := make(map[string][]string)
+	for _, change := range changes {
+		descriptions = append(descriptions, change.Description()...)
+		requires[change.Id()] = change.Requires()
+	}
+	c.Check(descriptions, jc.DeepEquals, []string{
+		"remove unit django/1",
+		"remove application mysql",
+		"remove machine 1/lxd/0",
+		"remove machine 1",
+		"remove machine 2",
+		"remove machine 3",
+	})
+	c.Check(requires, jc.DeepEquals, map[string][]string{
+		"removeUnit-0":        nil,
+		"removeApplication-1": nil,
+		"removeMachines-2":    {"removeUnit-0"},
+		"removeMachines-3":    {"removeApplication-1", "removeMachines-2"},
+		"removeMachines-4":    {"removeApplication-1"},
+		"removeMachines-5":    nil,
+	})
+}
+
+func (s *changesSuite) TestPruneKeepsMappedMachines(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 1
+                        to: ["0"]
+                    memcached:
+                        charm: cs:memcached-7
+                        num_units: 1
+                        to: ["1"]
+                machines:
+                    "0":
+                    "1":
+            `
+	existingModel := s.prunedMachinesModel()
+	existingModel.MachineMap = map[string]string{"1": "3"}
+	expectedChanges := []string{
+		"upload charm memcached from charm-store",
+		"deploy application memcached from charm-store",
+		"add unit memcached/0 to existing machine 3",
+		"remove unit django/1",
+		"remove application mysql",
+		"remove machine 1/lxd/0",
+		"remove machine 1",
+		"remove machine 2",
+	}
+	s.checkBundleWithConfig(c, bundleContent, bundlechanges.ChangesConfig{
+		Model: existingModel,
+		Prune: true,
+	}, expectedChanges, "")
+}
+
+func (s *changesSuite) TestRemoveMachinesWithoutPrune(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 1
+            `
+	s.checkBundleExistingModel(c, bundleContent, s.prunedMachinesModel(), []string{})
+}
+
+func (s *changesSuite) pruneChanges(c *gc.C, bundleContent string, existingModel *bundlechanges.Model) ([]bundlechanges.Change, error) {
+	data, err := charm.ReadBundleData(strings.NewReader(bundleContent))
+	c.Assert(err, jc.ErrorIsNil)
+	err = data.Verify(nil, nil, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	return bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model:  existingModel,
+		Logger: loggo.GetLogger("bundlechanges"),
+		Prune:  true,
+	})
+}
+
+func (s *changesSuite) TestDyingUnitReplaced(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 2
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				UnitLife: map[string]bundlechanges.Life{
+					"django/1": bundlechanges.Dying,
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "1"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+			"1": {ID: "1"},
+		},
+	}
+	expectedChanges := []string{
+		"add unit django/2 to new machine 2",
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestPruneSkipsDyingEntities(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 1
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				UnitLife: map[string]bundlechanges.Life{
+					"django/1": bundlechanges.Dying,
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "1"},
+				},
+			},
+			"old": {
+				Charm: "cs:old-1",
+				Life:  bundlechanges.Dying,
+				Units: []bundlechanges.Unit{
+					{Name: "old/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+			"1": {ID: "1"},
+			"2": {ID: "2", Life: bundlechanges.Dying},
+		},
+	}
+	changes, err := s.pruneChanges(c, bundleContent, existingModel)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(changes, gc.HasLen, 0)
+}
+
+func (s *changesSuite) TestDyingApplication(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 1
+                    mysql:
+                        charm: cs:mysql-1
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Life:  bundlechanges.Dying,
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	_, err := s.pruneChanges(c, bundleContent, existingModel)
+	c.Assert(err, gc.ErrorMatches, `bundle requires entities that are dying or in error: applications \[django\]`)
+	dyingErr, ok := errors.Cause(err).(*bundlechanges.DyingEntitiesError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(dyingErr.Applications, jc.DeepEquals, []string{"django"})
+	c.Check(dyingErr.Machines, gc.HasLen, 0)
+}
+
+func (s *changesSuite) TestApplicationInError(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-5
+                        num_units: 1
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:  "cs:django-4",
+				Status: "error",
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	_, err := s.pruneChanges(c, bundleContent, existingModel)
+	c.Assert(err, gc.ErrorMatches, `bundle requires entities that are dying or in error: applications \[django\]`)
+	dyingErr, ok := errors.Cause(err).(*bundlechanges.DyingEntitiesError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(dyingErr.Applications, jc.DeepEquals, []string{"django"})
+}
+
+func (s *changesSuite) TestPlacementOnUnusableMachines(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        num_units: 2
+                        to: ["0", "lxd:1"]
+                machines:
+                    "0":
+                    "1":
+            `
+	existingModel := &bundlechanges.Model{
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0", Life: bundlechanges.Dying},
+			"1": {ID: "1", Status: "error"},
+		},
+		MachineMap: map[string]string{"0": "0", "1": "1"},
+	}
+	data, err := charm.ReadBundleData(strings.NewReader(bundleContent))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model:  existingModel,
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, gc.ErrorMatches, `bundle requires entities that are dying or in error: machines \[0, 1\]`)
+	dyingErr, ok := errors.Cause(err).(*bundlechanges.DyingEntitiesError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(dyingErr.Machines, jc.DeepEquals, []string{"0", "1"})
+}
+
+func (s *changesSuite) TestUnknownSpaces(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        bindings:
+                            "": alpha
+                            db: internal
+                        exposed-endpoints:
+                            website:
+                                expose-to-spaces: [public]
+            `
+	existingModel := &bundlechanges.Model{
+		Spaces: map[string]*bundlechanges.Space{
+			"alpha": {Name: "alpha"},
+		},
+	}
+	_, err := s.pruneChanges(c, bundleContent, existingModel)
+	c.Assert(err, gc.ErrorMatches, `bundle refers to unknown spaces: `+
+		`space "internal" in binding of endpoint "db" of application "django", `+
+		`space "public" in expose of endpoint "website" of application "django"`)
+	spacesErr, ok := errors.Cause(err).(*bundlechanges.UnknownSpacesError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(spacesErr.References, jc.DeepEquals, []bundlechanges.SpaceReference{
+		{Space: "internal", Application: "django", Usage: "binding", Endpoint: "db"},
+		{Space: "public", Application: "django", Usage: "expose", Endpoint: "website"},
+	})
+}
+
+func (s *changesSuite) TestAddStorageToExistingApplication(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        storage:
+                            data: ebs,10G
+                            logs: ebs,1G
+                            cache: tmpfs,100M
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Storage: map[string]string{
+					"data": "ebs,10G",
+				},
+			},
+		},
+	}
+	expectedChanges := []string{
+		`add storage cache to django using "tmpfs,100M"`,
+		`add storage logs to django using "ebs,1G"`,
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestStorageOfExistingApplicationUnknown(c *gc.C) {
+	bundleContent := `
+                applications:
+                    pg:
+                        charm: cs:postgresql-7
+                        storage:
+                            pgdata: ebs,10G
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"pg": {
+				Charm: "cs:postgresql-7",
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestAddStorageWithCharmUpgrade(c *gc.C) {
+	content := `
+        applications:
+            django:
+                charm: cs:django-5
+                storage:
+                    data: ebs,10G
+                    logs: ebs,1G
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:   "cs:django-4",
+				Storage: map[string]string{"data": "ebs,10G"},
+			},
+		},
+	}
+	expected := []record{{
+		Id:     "addCharm-0",
+		Method: "addCharm",
+		Params: bundlechanges.AddCharmParams{
+			Charm: "cs:django-5",
+		},
+		GUIArgs: []interface{}{"cs:django-5", "", ""},
+		Args: map[string]interface{}{
+			"charm": "cs:django-5",
+		},
+	}, {
+		Id:       "upgradeCharm-1",
+		Requires: []string{"addCharm-0"},
+		Method:   "upgradeCharm",
+		Params: bundlechanges.UpgradeCharmParams{
+			Charm:       "$addCharm-0",
+			Application: "django",
+		},
+		GUIArgs: []interface{}{"$addCharm-0", "django", "", ""},
+		Args: map[string]interface{}{
+			"application": "django",
+			"charm":       "$addCharm-0",
+			"series":      "",
+		},
+	}, {
+		Id:       "addStorage-2",
+		Requires: []string{"upgradeCharm-1"},
+		Method:   "addStorage",
+		Params: bundlechanges.AddStorageParams{
+			Application: "django",
+			StorageName: "logs",
+			Storage:     "ebs,1G",
+		},
+		GUIArgs: []interface{}{"django", "logs", "ebs,1G"},
+		Args: map[string]interface{}{
+			"application":  "django",
+			"storage-name": "logs",
+			"storage":      "ebs,1G",
+		},
+	}}
+	s.assertParseDataWithModel(c, model, content, expected)
+}
+
+func (s *changesSuite) TestChangeStorageOfExistingApplication(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        storage:
+                            data: ebs,20G
+                            logs: ebs,1G
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Storage: map[string]string{
+					"data": "ebs,10G",
+				},
+			},
+		},
+	}
+	data, err := charm.ReadBundleData(strings.NewReader(bundleContent))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model:  existingModel,
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot change storage \[data\] of deployed application "django": storage directives can only be set for new storage`)
+	storageErr, ok := errors.Cause(err).(*bundlechanges.StorageChangeError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(storageErr.Application, gc.Equals, "django")
+	c.Check(storageErr.Storage, jc.DeepEquals, []string{"data"})
+}
+
+func (s *changesSuite) TestAddStorageChangeArgs(c *gc.C) {
+	content := `
+        applications:
+            django:
+                charm: cs:django-4
+                storage:
+                    data: ebs,10G
+                    logs: ebs,1G
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:   "cs:django-4",
+				Storage: map[string]string{"logs": "ebs,1G"},
+			},
+		},
+	}
+	expected := []record{{
+		Id:     "addStorage-0",
+		Method: "addStorage",
+		Params: bundlechanges.AddStorageParams{
+			Application: "django",
+			StorageName: "data",
+			Storage:     "ebs,10G",
+		},
+		GUIArgs: []interface{}{"django", "data", "ebs,10G"},
+		Args: map[string]interface{}{
+			"application":  "django",
+			"storage-name": "data",
+			"storage":      "ebs,10G",
+		},
+	}}
+	s.assertParseDataWithModel(c, model, content, expected)
+}
+
+func (s *changesSuite) TestBindExistingApplication(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        bindings:
+                            "": beta
+                            db: internal
+                            website: public
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				EndpointBindings: map[string]string{
+					"":        "alpha",
+					"db":      "internal",
+					"website": "alpha",
+				},
+			},
+		},
+	}
+	expectedChanges := []string{
+		"bind endpoints of django: default space beta, website=public",
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestBindExistingApplicationUnchanged(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        bindings:
+                            db: internal
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				EndpointBindings: map[string]string{
+					"":   "alpha",
+					"db": "internal",
+				},
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestBindExistingApplicationUnknown(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        bindings:
+                            "": alpha
+                            db: internal
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestBindChangeArgs(c *gc.C) {
+	content := `
+        applications:
+            django:
+                charm: cs:django-4
+                bindings:
+                    db: internal
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				EndpointBindings: map[string]string{
+					"":   "alpha",
+					"db": "alpha",
+				},
+			},
+		},
+	}
+	expected := []record{{
+		Id:     "bind-0",
+		Method: "bind",
+		Params: bundlechanges.BindParams{
+			Application:      "django",
+			EndpointBindings: map[string]string{"db": "internal"},
+		},
+		GUIArgs: []interface{}{"django", map[string]string{"db": "internal"}},
+		Args: map[string]interface{}{
+			"application": "django",
+			"endpoint-bindings": map[string]interface{}{
+				"db": "internal",
+			},
+		},
+	}}
+	s.assertParseDataWithModel(c, model, content, expected)
+}
+
+func (s *changesSuite) TestUpgradeResourcesOnly(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        resources:
+                            data: 3
+                            static: ./static.tar
+                            config: ./config.tar
+                            logs: 1
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:     "cs:django-4",
+				Resources: map[string]int{"data": 2, "logs": 1},
+				LocalResources: map[string]string{
+					"config": "./config.tar",
+				},
+			},
+		},
+	}
+	expectedChanges := []string{
+		"upgrade django resources data, static",
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestUpgradeResourcesOnlyParams(c *gc.C) {
+	content := `
+        applications:
+            django:
+                charm: cs:django-4
+                resources:
+                    data: 3
+                    logs: 1
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:     "cs:django-4",
+				Resources: map[string]int{"data": 2, "logs": 1},
+			},
+		},
+	}
+	expected := []record{{
+		Id:     "upgradeCharm-0",
+		Method: "upgradeCharm",
+		Params: bundlechanges.UpgradeCharmParams{
+			Charm:       "cs:django-4",
+			Application: "django",
+			Resources:   map[string]int{"data": 3},
+		},
+		GUIArgs: []interface{}{"cs:django-4", "django", "", ""},
+		Args: map[string]interface{}{
+			"application": "django",
+			"charm":       "cs:django-4",
+			"series":      "",
+			"resources": map[string]interface{}{
+				"data": float64(3),
+			},
+		},
+	}}
+	s.assertParseDataWithModel(c, model, content, expected)
+}
+
+func (s *changesSuite) TestUpgradeResourcesUnchanged(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        resources:
+                            data: 3
+                            config: ./config.tar
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:     "cs:django-4",
+				Resources: map[string]int{"data": 3},
+				LocalResources: map[string]string{
+					"config": "./config.tar",
+				},
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestUpgradeResourcesUnknown(c *gc.C) {
+	bundleContent := `
+                applications:
+                    pg:
+                        charm: cs:postgresql-7
+                        resources:
+                            foo: 3
+                            bar: ./bar.tar
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"pg": {
+				Charm: "cs:postgresql-7",
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestDevicesOfExistingApplicationUnchanged(c *gc.C) {
+	bundleContent := `
+                bundle: kubernetes
+                applications:
+                    tensorflow:
+                        charm: cs:tensorflow-3
+                        scale: 1
+                        devices:
+                            bitcoinminer: 2,nvidia.com/gpu
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"tensorflow": {
+				Charm:  "cs:tensorflow-3",
+				Series: "kubernetes",
+				Scale:  1,
+				Devices: map[string]string{
+					"bitcoinminer": "2,nvidia.com/gpu",
+				},
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestDevicesOfExistingApplicationUnknown(c *gc.C) {
+	bundleContent := `
+                bundle: kubernetes
+                applications:
+                    gpu:
+                        charm: cs:gpu-3
+                        scale: 1
+                        devices:
+                            bitcoinminer: 1,nvidia.com/gpu
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"gpu": {
+				Charm:  "cs:gpu-3",
+				Series: "kubernetes",
+				Scale:  1,
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestChangeDevicesOfExistingApplication(c *gc.C) {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        bundle: kubernetes
+        applications:
+            tensorflow:
+                charm: cs:tensorflow-3
+                scale: 1
+                devices:
+                    bitcoinminer: 2,nvidia.com/gpu
+                    tpu: 1,google.com/tpu
+    `))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model: &bundlechanges.Model{
+			Applications: map[string]*bundlechanges.Application{
+				"tensorflow": {
+					Charm:  "cs:tensorflow-3",
+					Series: "kubernetes",
+					Scale:  1,
+					Devices: map[string]string{
+						"bitcoinminer": "1,nvidia.com/gpu",
+					},
+				},
+			},
+		},
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot change devices \[bitcoinminer, tpu\] of deployed application "tensorflow": devices can only be requested when deploying`)
+	deviceErr, ok := errors.Cause(err).(*bundlechanges.DeviceChangeError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(deviceErr.Application, gc.Equals, "tensorflow")
+	c.Check(deviceErr.Devices, jc.DeepEquals, []string{"bitcoinminer", "tpu"})
+}
+
+func (s *changesSuite) TestDeployWithTrust(c *gc.C) {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        bundle: kubernetes
+        applications:
+            aws-integrator:
+                charm: cs:aws-integrator-10
+                scale: 1
+                trust: true
+    `))
+	c.Assert(err, jc.ErrorIsNil)
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(changes, gc.HasLen, 2)
+	change, ok := changes[1].(*bundlechanges.AddApplicationChange)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(change.Params.Trust, jc.IsTrue)
+	args, err := change.Args()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(args["trust"], gc.Equals, true)
+}
+
+func (s *changesSuite) TestSetTrustOfExistingApplications(c *gc.C) {
+	trusted, untrusted := true, false
+	bundleContent := `
+                bundle: kubernetes
+                applications:
+                    aws-integrator:
+                        charm: cs:aws-integrator-10
+                        scale: 1
+                        trust: true
+                    django:
+                        charm: cs:django-4
+                        scale: 1
+                    mysql:
+                        charm: cs:mysql-2
+                        scale: 1
+                        trust: true
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"aws-integrator": {
+				Charm:  "cs:aws-integrator-10",
+				Series: "kubernetes",
+				Scale:  1,
+				Trust:  &untrusted,
+			},
+			"django": {
+				Charm:  "cs:django-4",
+				Series: "kubernetes",
+				Scale:  1,
+				Trust:  &trusted,
+			},
+			"mysql": {
+				Charm:  "cs:mysql-2",
+				Series: "kubernetes",
+				Scale:  1,
+				Trust:  &trusted,
+			},
+		},
+	}
+	expectedChanges := []string{
+		"grant trust to aws-integrator",
+		"revoke trust from django",
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestSetTrustOfExistingApplicationUnknown(c *gc.C) {
+	bundleContent := `
+                applications:
+                    django:
+                        charm: cs:django-4
+                        trust: true
+            `
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+			},
+		},
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, []string{})
+}
+
+func (s *changesSuite) TestSetTrustChangeArgs(c *gc.C) {
+	content := `
+        applications:
+            django:
+                charm: cs:django-4
+                trust: true
+    `
+	untrusted := false
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm: "cs:django-4",
+				Trust: &untrusted,
+			},
+		},
+	}
+	expected := []record{{
+		Id:     "setTrust-0",
+		Method: "setTrust",
+		Params: bundlechanges.SetTrustParams{
+			Application: "django",
+			Trust:       true,
+		},
+		GUIArgs: []interface{}{"django", true},
+		Args: map[string]interface{}{
+			"application": "django",
+			"trust":       true,
+		},
+	}}
+	s.assertParseDataWithModel(c, model, content, expected)
+}
+
+func (s *changesSuite) offersModel() *bundlechanges.Model {
+	return &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"apache2": {
+				Name:   "apache2",
+				Charm:  "cs:apache2-26",
+				Offers: []string{"offer1", "offer2"},
+				OfferACLs: map[string]map[string]string{
+					"offer1": {
+						"bob":   "consume",
+						"foo":   "admin",
+						"alice": "read",
+					},
+				},
+			},
+			"mysql": {
+				Name:   "mysql",
+				Charm:  "cs:mysql-2",
+				Offers: []string{"db"},
+			},
+		},
+	}
+}
+
+const offersBundle = `
+applications:
+  apache2:
+    charm: "cs:apache2-26"
+--- #overlay
+applications:
+  apache2:
+    offers:
+      offer1:
+        endpoints:
+          - "apache-website"
+        acl:
+          alice: consume
+          foo: read
+          bar: read
+`
+
+func (s *changesSuite) TestOfferAccessNotGrantedTwice(c *gc.C) {
+	bundleContent := `
+applications:
+  apache2:
+    charm: "cs:apache2-26"
+--- #overlay
+applications:
+  apache2:
+    offers:
+      offer1:
+        endpoints:
+          - "apache-website"
+        acl:
+          bob: consume
+          foo: consume
+          bar: read
+`
+	expectedChanges := []string{
+		"update offer offer1 using apache2:apache-website",
+		"grant user bar read access to offer offer1",
+	}
+	existingModel := s.offersModel()
+	delete(existingModel.Applications, "mysql")
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestOfferAccessWithoutPrune(c *gc.C) {
+	expectedChanges := []string{
+		"update offer offer1 using apache2:apache-website",
+		"grant user alice consume access to offer offer1",
+		"grant user bar read access to offer offer1",
+	}
+	s.checkBundleExistingModel(c, offersBundle, s.offersModel(), expectedChanges)
+}
+
+func (s *changesSuite) TestPruneOffers(c *gc.C) {
+	expectedChanges := []string{
+		"update offer offer1 using apache2:apache-website",
+		"grant user alice consume access to offer offer1",
+		"grant user bar read access to offer offer1",
+		"revoke read access to offer offer1 from user bob",
+		"revoke consume access to offer offer1 from user foo",
+		"remove offer offer2 of apache2",
+		"remove offer db of mysql",
+		"remove application mysql",
+	}
+	s.checkBundleWithConfig(c, offersBundle, bundlechanges.ChangesConfig{
+		Model: s.offersModel(),
+		Prune: true,
+	}, expectedChanges, "")
+}
+
+func (s *changesSuite) TestPruneOffersOrderedBeforeApplications(c *gc.C) {
+	changes, err := s.pruneChanges(c, `
+        applications:
+            apache2:
+                charm: cs:apache2-26
+    `, s.offersModel())
+	c.Assert(err, jc.ErrorIsNil)
+	var application *bundlechanges.RemoveApplicationChange
+	for _, change := range changes {
+		if change, ok := change.(*bundlechanges.RemoveApplicationChange); ok {
+			application = change
+		}
+	}
+	c.Assert(application, gc.NotNil)
+	c.Check(application.Params.Application, gc.Equals, "mysql")
+	c.Check(application.Requires(), jc.DeepEquals, []string{"removeOffer-2"})
+}
+
+func (s *changesSuite) TestRemoveOfferChangeArgs(c *gc.C) {
+	content := `
+        applications:
+            apache2:
+                charm: cs:apache2-26
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"apache2": {
+				Name:   "apache2",
+				Charm:  "cs:apache2-26",
+				Offers: []string{"offer1"},
+			},
+		},
+	}
+	expected := []record{{
+		Id:     "removeOffer-0",
+		Method: "removeOffer",
+		Params: bundlechanges.RemoveOfferParams{
+			Application: "apache2",
+			OfferName:   "offer1",
+		},
+		GUIArgs: []interface{}{"apache2", "offer1"},
+		Args: map[string]interface{}{
+			"application": "apache2",
+			"offer-name":  "offer1",
+		},
+	}}
+	s.assertParseDataWithConfig(c, bundlechanges.ChangesConfig{
+		Model: model,
+		Prune: true,
+	}, content, expected)
+}
+
+func (s *changesSuite) TestSaasAlreadyConsumed(c *gc.C) {
+	bundleContent := `
+saas:
+  keystone:
+    url: production:admin/info.keystone
+  mysql:
+    url: production:admin/info.mysql
+applications:
+  apache2:
+    charm: cs:apache2-26
+relations:
+- - apache2:identity
+  - keystone:identity
+- - apache2:db
+  - mysql:db
+`
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"apache2": {
+				Name:  "apache2",
+				Charm: "cs:apache2-26",
+			},
+		},
+		RemoteApplications: map[string]*bundlechanges.RemoteApplication{
+			"keystone": {
+				Name:     "keystone",
+				OfferURL: "production:admin/info.keystone",
+			},
+		},
+		Relations: []bundlechanges.Relation{{
+			App1:      "apache2",
+			Endpoint1: "identity",
+			App2:      "keystone",
+			Endpoint2: "identity",
+		}},
+	}
+	expectedChanges := []string{
+		"consume offer mysql at production:admin/info.mysql",
+		"add relation apache2:db - mysql:db",
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestSaasRelationToConsumedOffer(c *gc.C) {
+	bundleContent := `
+saas:
+  keystone:
+    url: production:admin/info.keystone
+applications:
+  apache2:
+    charm: cs:apache2-26
+relations:
+- - apache2:identity
+  - keystone:identity
+`
+	existingModel := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"apache2": {
+				Name:  "apache2",
+				Charm: "cs:apache2-26",
+			},
+		},
+		RemoteApplications: map[string]*bundlechanges.RemoteApplication{
+			"keystone": {
+				Name:     "keystone",
+				OfferURL: "production:admin/info.keystone",
+			},
+		},
+	}
+	expectedChanges := []string{
+		"add relation apache2:identity - keystone:identity",
+	}
+	s.checkBundleExistingModel(c, bundleContent, existingModel, expectedChanges)
+}
+
+func (s *changesSuite) TestSaasConflict(c *gc.C) {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        saas:
+            keystone:
+                url: production:admin/info.keystone
+        applications:
+            apache2:
+                charm: cs:apache2-26
+    `))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model: &bundlechanges.Model{
+			RemoteApplications: map[string]*bundlechanges.RemoteApplication{
+				"keystone": {
+					Name:     "keystone",
+					OfferURL: "staging:admin/info.keystone",
+				},
+			},
+		},
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot consume offer "production:admin/info.keystone" as "keystone": the model already consumes offer "staging:admin/info.keystone" under that name`)
+	saasErr, ok := errors.Cause(err).(*bundlechanges.SaasConflictError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(saasErr, jc.DeepEquals, &bundlechanges.SaasConflictError{
+		Name:        "keystone",
+		URL:         "production:admin/info.keystone",
+		ExistingURL: "staging:admin/info.keystone",
+	})
+}
+
+func (s *changesSuite) TestRemoveApplicationChangeArgs(c *gc.C) {
+	content := `
+        applications:
+            django:
+                charm: cs:django-4
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {Charm: "cs:django-4"},
+			"mysql":  {Charm: "cs:mysql-2"},
+		},
+	}
+	expected := []record{{
+		Id:     "removeApplication-0",
+		Method: "removeApplication",
+		Params: bundlechanges.RemoveApplicationParams{
+			Application: "mysql",
+		},
+		GUIArgs: []interface{}{"mysql"},
+		Args: map[string]interface{}{
+			"application": "mysql",
+		},
+	}}
+	s.assertParseDataWithConfig(c, bundlechanges.ChangesConfig{
+		Model: model,
+		Prune: true,
+	}, content, expected)
+}
+
+func (s *changesSuite) checkBundle(c *gc.C, bundleContent string, expectedChanges []string) {
+	s.checkBundleImpl(c, bundleContent, nil, expectedChanges, "", nil, nil)
+}
+
+func (s *changesSuite) checkBundleExistingModel(c *gc.C, bundleContent string, existingModel *bundlechanges.Model, expectedChanges []string) {
+	s.checkBundleImpl(c, bundleContent, existingModel, expectedChanges, "", nil, nil)
+}
+
+func (s *changesSuite) checkBundleError(c *gc.C, bundleContent string, errMatch string) {
+	s.checkBundleImpl(c, bundleContent, nil, nil, errMatch, nil, nil)
+}
+
+func (s *changesSuite) checkBundleWithConstraintsParser(c *gc.C, bundleContent string, expectedChanges []string, parserFn bundlechanges.ConstraintGetter) {
+	s.checkBundleImpl(c, bundleContent, nil, expectedChanges, "", parserFn, nil)
+}
+
+func (s *changesSuite) checkBundleExistingModelWithConstraintsParser(c *gc.C, bundleContent string, existingModel *bundlechanges.Model, expectedChanges []string, parserFn bundlechanges.ConstraintGetter) {
+	s.checkBundleImpl(c, bundleContent, existingModel, expectedChanges, "", parserFn, nil)
+}
+
+func (s *changesSuite) checkBundleWithConstraintsParserError(c *gc.C, bundleContent, errMatch string, parserFn bundlechanges.ConstraintGetter) {
+	s.checkBundleImpl(c, bundleContent, nil, nil, errMatch, parserFn, nil)
+}
+
+func (s *changesSuite) checkBundleExistingModelWithRevisionParser(c *gc.C, bundleContent string, existingModel *bundlechanges.Model, expectedChanges []string, charmResolverFn bundlechanges.CharmResolver) {
+	s.checkBundleImpl(c, bundleContent, existingModel, expectedChanges, "", nil, charmResolverFn)
+}
+
+func (s *changesSuite) checkBundleImpl(c *gc.C,
+	bundleContent string,
+	existingModel *bundlechanges.Model,
+	expectedChanges []string,
+	errMatch string,
+	parserFn bundlechanges.ConstraintGetter,
+	charmResolverFn bundlechanges.CharmResolver,
+) {
+	s.checkBundleWithConfig(c, bundleContent, bundlechanges.ChangesConfig{
 		Model:            existingModel,
-		Logger:           loggo.GetLogger("bundlechanges"),
 		ConstraintGetter: parserFn,
 		CharmResolver:    charmResolverFn,
-	})
+	}, expectedChanges, errMatch)
+}
+
+// checkBundleWithConfig reads the bundle content into the Bundle of the
+// given config, and checks the descriptions of the changes produced by
+// FromData.
+func (s *changesSuite) checkBundleWithConfig(c *gc.C,
+	bundleContent string,
+	config bundlechanges.ChangesConfig,
+	expectedChanges []string,
+	errMatch string,
+) {
+	// Retrieve and validate the bundle data merging any overlays in the bundle contents.
+	bundleSrc, err := charm.StreamBundleDataSource(strings.NewReader(bundleContent), "./")
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := charm.ReadAndMergeBundleData(bundleSrc)
+	c.Assert(err, jc.ErrorIsNil)
+	err = data.Verify(nil, nil, nil)
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Retrieve the changes, and convert them to a sequence of records.
+	config.Bundle = data
+	config.Logger = loggo.GetLogger("bundlechanges")
+	changes, err := bundlechanges.FromData(config)
 	if errMatch != "" {
 		c.Assert(err, gc.ErrorMatches, errMatch)
 	} else {
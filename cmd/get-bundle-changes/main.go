@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/juju/charm/v9"
 	"github.com/juju/loggo"
@@ -16,6 +18,11 @@ import (
 	"github.com/juju/bundlechanges/v5"
 )
 
+var (
+	waves  = flag.Bool("waves", false, "print the changes in waves of changes that can be applied in parallel")
+	limits = flag.String("limits", "", "maximum number of changes per wave by method, such as addUnit=5,addRelation=10")
+)
+
 func main() {
 	flag.Usage = usage
 	flag.Parse()
@@ -23,16 +30,20 @@ func main() {
 		fmt.Fprintln(os.Stderr, "need a bundle path as first and only argument")
 		os.Exit(2)
 	}
+	waveLimits, err := parseLimits(*limits)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid limits: %s\n", err)
+		os.Exit(2)
+	}
 	r := os.Stdin
 	if path := flag.Arg(0); path != "" {
-		var err error
 		if r, err = os.Open(path); err != nil {
 			fmt.Fprintf(os.Stderr, "invalid bundle path: %s\n", err)
 			os.Exit(2)
 		}
 		defer r.Close()
 	}
-	if err := process(r, os.Stdout); err != nil {
+	if err := process(r, os.Stdout, *waves, waveLimits); err != nil {
 		if verr, ok := err.(*charm.VerificationError); ok {
 			fmt.Fprintf(os.Stderr, "the given bundle is not valid:\n")
 			for _, err := range verr.Errors {
@@ -47,15 +58,37 @@ func main() {
 
 // usage outputs instructions on how to use this command.
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: get-bundle-changes [bundle]")
+	fmt.Fprintln(os.Stderr, "usage: get-bundle-changes [-waves] [-limits method=n,...] [bundle]")
 	fmt.Fprintln(os.Stderr, "bundle can also be provided on stdin")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
+// parseLimits parses wave limits of the form "addUnit=5,addRelation=10".
+func parseLimits(value string) (map[string]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	result := make(map[string]int)
+	for _, limit := range strings.Split(value, ",") {
+		parts := strings.SplitN(limit, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected method=n, got %q", limit)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit for %s: %v", parts[0], err)
+		}
+		result[parts[0]] = n
+	}
+	return result, nil
+}
+
 // process generates and print to w the set of changes required to deploy
-// the bundle data to be retrieved using r.
-func process(r io.Reader, w io.Writer) error {
+// the bundle data to be retrieved using r. If inWaves is true, the changes
+// are printed in waves of changes that can be applied in parallel, with
+// the given limits per method.
+func process(r io.Reader, w io.Writer, inWaves bool, limits map[string]int) error {
 	// Read the bundle data.
 	data, err := charm.ReadBundleData(r)
 	if err != nil {
@@ -73,6 +106,29 @@ func process(r io.Reader, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	var output interface{} = toRecords(changes)
+	if inWaves {
+		changeWaves, err := bundlechanges.Waves(changes, limits)
+		if err != nil {
+			return err
+		}
+		waveRecords := make([][]*record, len(changeWaves))
+		for i, wave := range changeWaves {
+			waveRecords[i] = toRecords(wave)
+		}
+		output = waveRecords
+	}
+	// Serialize and print the records.
+	content, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(content))
+	return nil
+}
+
+// toRecords converts the changes to their standard form.
+func toRecords(changes []bundlechanges.Change) []*record {
 	records := make([]*record, len(changes))
 	for i, change := range changes {
 		records[i] = &record{
@@ -82,13 +138,7 @@ func process(r io.Reader, w io.Writer) error {
 			Args:     change.GUIArgs(),
 		}
 	}
-	// Serialize and print the records.
-	content, err := json.MarshalIndent(records, "", "  ")
-	if err != nil {
-		return err
-	}
-	fmt.Fprintln(w, string(content))
-	return nil
+	return records
 }
 
 // record holds the JSON representation of a change.
@@ -11,6 +11,7 @@ import (
 	"github.com/juju/charm/v9"
 	"github.com/juju/collections/set"
 	"github.com/juju/errors"
+	"github.com/juju/names/v4"
 )
 
 // DiffSide represents one side of a bundle-model diff.
@@ -65,13 +66,23 @@ func BuildDiff(config DiffConfig) (*BundleDiff, error) {
 
 type differ struct {
 	config DiffConfig
+
+	// placementModel is a copy of the model with the machine map
+	// completed by inference, used to resolve unit placements.
+	placementModel *Model
 }
 
 func (d *differ) build() (*BundleDiff, error) {
+	if err := d.config.Model.validateSpaces(d.config.Bundle); err != nil {
+		return nil, errors.Trace(err)
+	}
+	d.placementModel = d.inferredModel()
 	return &BundleDiff{
 		Applications: d.diffApplications(),
 		Machines:     d.diffMachines(),
 		Relations:    d.diffRelations(),
+		Offers:       d.diffOffers(),
+		Saas:         d.diffSaas(),
 	}, nil
 }
 
@@ -151,10 +162,27 @@ func (d *differ) diffApplication(name string) *ApplicationDiff {
 		Channel:          d.diffStrings(bundle.Channel, model.Channel),
 		Constraints:      d.diffStrings(bundle.Constraints, model.Constraints),
 		Options:          d.diffOptions(bundle.Options, model.Options),
+		Resources:        d.diffResources(bundle.Resources, model),
 	}
 
+	if model.Trust != nil {
+		// Trust is only compared when the model reports it.
+		result.Trust = d.diffBools(bundle.RequiresTrust, *model.Trust)
+	}
+	if model.Storage != nil {
+		// Storage is only compared when the model reports it.
+		result.Storage = d.diffBundleValues(bundle.Storage, model.Storage)
+	}
+	if model.Devices != nil {
+		// Devices are only compared when the model reports them.
+		result.Devices = d.diffBundleValues(bundle.Devices, model.Devices)
+	}
+	if model.EndpointBindings != nil {
+		// Bindings are only compared when the model reports them.
+		result.EndpointBindings = d.diffBundleValues(bundle.EndpointBindings, model.EndpointBindings)
+	}
 	if d.config.IncludeAnnotations {
-		result.Annotations = d.diffAnnotations(bundle.Annotations, model.Annotations)
+		result.Annotations = d.diffStringMaps(bundle.Annotations, model.Annotations)
 	}
 	if len(model.SubordinateTo) == 0 {
 		// We don't check num_units for subordinate apps.
@@ -162,6 +190,7 @@ func (d *differ) diffApplication(name string) *ApplicationDiff {
 			result.Scale = d.diffInts(bundle.NumUnits, model.Scale)
 		} else {
 			result.NumUnits = d.diffInts(bundle.NumUnits, len(model.Units))
+			result.UnitPlacement = d.diffUnitPlacement(bundle, model)
 		}
 	}
 	if d.config.Bundle.Type == kubernetes && len(bundle.To) > 0 {
@@ -174,6 +203,178 @@ func (d *differ) diffApplication(name string) *ApplicationDiff {
 	return result
 }
 
+// offer holds the details of an offer from either side of the diff.
+type offer struct {
+	application string
+	endpoints   []string
+	acl         map[string]string
+}
+
+func (d *differ) diffOffers() map[string]*OfferDiff {
+	bundleOffers := make(map[string]offer)
+	for appName, app := range d.config.Bundle.Applications {
+		for name, spec := range app.Offers {
+			bundleOffers[name] = offer{
+				application: appName,
+				endpoints:   spec.Endpoints,
+				acl:         spec.ACL,
+			}
+		}
+	}
+	modelOffers := make(map[string]offer)
+	for appName, app := range d.config.Model.Applications {
+		for _, name := range app.Offers {
+			modelOffers[name] = offer{
+				application: appName,
+				endpoints:   app.OfferEndpoints[name],
+				acl:         app.OfferACLs[name],
+			}
+		}
+	}
+
+	allOffers := set.NewStrings()
+	for name := range bundleOffers {
+		allOffers.Add(name)
+	}
+	for name := range modelOffers {
+		allOffers.Add(name)
+	}
+
+	results := make(map[string]*OfferDiff)
+	for _, name := range allOffers.SortedValues() {
+		bundle, found := bundleOffers[name]
+		if !found {
+			results[name] = &OfferDiff{Missing: BundleSide}
+			continue
+		}
+		model, found := modelOffers[name]
+		if !found {
+			results[name] = &OfferDiff{Missing: ModelSide}
+			continue
+		}
+		diff := &OfferDiff{
+			Application: d.diffStrings(bundle.application, model.application),
+		}
+		// The endpoints and ACL of the offers are only compared when the
+		// model provides them.
+		if model.endpoints != nil {
+			diff.Endpoints = d.diffStringSets(bundle.endpoints, model.endpoints)
+		}
+		if model.acl != nil {
+			diff.ACL = d.diffStringMaps(bundle.acl, model.acl)
+		}
+		if !diff.Empty() {
+			results[name] = diff
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return results
+}
+
+func (d *differ) diffSaas() map[string]*SaasDiff {
+	if d.config.Model.RemoteApplications == nil {
+		// The remote applications of the model are not known.
+		return nil
+	}
+	allSaas := set.NewStrings()
+	for name := range d.config.Bundle.Saas {
+		allSaas.Add(name)
+	}
+	for name := range d.config.Model.RemoteApplications {
+		allSaas.Add(name)
+	}
+
+	results := make(map[string]*SaasDiff)
+	for _, name := range allSaas.SortedValues() {
+		bundle, found := d.config.Bundle.Saas[name]
+		if !found {
+			results[name] = &SaasDiff{Missing: BundleSide}
+			continue
+		}
+		model, found := d.config.Model.RemoteApplications[name]
+		if !found {
+			results[name] = &SaasDiff{Missing: ModelSide}
+			continue
+		}
+		if url := d.diffStrings(bundle.URL, model.OfferURL); url != nil {
+			results[name] = &SaasDiff{URL: url}
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return results
+}
+
+// inferredModel returns a copy of the model whose machine map is extended
+// with the same inference used when computing changes. The model itself is
+// left untouched, so that the machine diff only uses the given mapping.
+func (d *differ) inferredModel() *Model {
+	model := *d.config.Model
+	model.MachineMap = make(map[string]string, len(d.config.Model.MachineMap))
+	for bundleMachine, modelMachine := range d.config.Model.MachineMap {
+		model.MachineMap[bundleMachine] = modelMachine
+	}
+	model.logger = d.config.Logger
+	model.InferMachineMap(d.config.Bundle)
+	return &model
+}
+
+// diffUnitPlacement returns the units that are not where the placement
+// directives of the bundle ask for. Each directive is first matched with
+// a unit satisfying it, then the units left over are paired in order with
+// the unsatisfied directives.
+func (d *differ) diffUnitPlacement(bundle *charm.ApplicationSpec, model *Application) map[string]StringDiff {
+	if len(bundle.To) == 0 {
+		return nil
+	}
+	units := append([]Unit(nil), model.Units...)
+	sort.SliceStable(units, func(i, j int) bool {
+		return unitNumber(units[i].Name) < unitNumber(units[j].Name)
+	})
+
+	matched := make([]bool, len(units))
+	var unsatisfied []string
+	for _, directive := range bundle.To {
+		placement, err := charm.ParsePlacement(directive)
+		if err != nil || placement == nil {
+			continue
+		}
+		found := false
+		for i, unit := range units {
+			if !matched[i] && d.placementModel.unitMatchesPlacement(unit, placement) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			unsatisfied = append(unsatisfied, directive)
+		}
+	}
+
+	result := make(map[string]StringDiff)
+	for i, unit := range units {
+		if len(unsatisfied) == 0 {
+			break
+		}
+		if matched[i] {
+			continue
+		}
+		result[unit.Name] = StringDiff{
+			Bundle: d.placementModel.resolvePlacement(unsatisfied[0]),
+			Model:  unit.Machine,
+		}
+		unsatisfied = unsatisfied[1:]
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
 func (d *differ) diffMachines() map[string]*MachineDiff {
 	unseen := set.NewStrings()
 	for machineID := range d.config.Model.Machines {
@@ -208,9 +409,16 @@ func (d *differ) diffMachines() map[string]*MachineDiff {
 			Series: d.diffStrings(
 				bundleSeries, modelMachine.Series,
 			),
+			Constraints: d.diffConstraints(
+				bundleMachine.Constraints, modelMachine.Constraints,
+			),
+			// Bundle machines are never containers.
+			ContainerType: d.diffStrings(
+				"", modelMachine.containerType(),
+			),
 		}
 		if d.config.IncludeAnnotations {
-			diff.Annotations = d.diffAnnotations(
+			diff.Annotations = d.diffStringMaps(
 				bundleMachine.Annotations, modelMachine.Annotations,
 			)
 		}
@@ -220,9 +428,11 @@ func (d *differ) diffMachines() map[string]*MachineDiff {
 	}
 
 	// Add missing bundle machines for any model machines that weren't
-	// seen.
+	// seen. Containers are not reported, as bundles can't declare them.
 	for _, modelName := range unseen.Values() {
-		results[modelName] = &MachineDiff{Missing: BundleSide}
+		if !names.IsContainerMachine(modelName) {
+			results[modelName] = &MachineDiff{Missing: BundleSide}
+		}
 	}
 
 	if len(results) == 0 {
@@ -231,6 +441,18 @@ func (d *differ) diffMachines() map[string]*MachineDiff {
 	return results
 }
 
+// diffConstraints compares the constraints with the model ConstraintsEqual
+// function when it is set, and as strings otherwise.
+func (d *differ) diffConstraints(bundle, model string) *StringDiff {
+	if equal := d.config.Model.ConstraintsEqual; equal != nil {
+		if equal(bundle, model) {
+			return nil
+		}
+		return &StringDiff{Bundle: bundle, Model: model}
+	}
+	return d.diffStrings(bundle, model)
+}
+
 func (d *differ) toModelMachineID(bundleMachineID string) string {
 	result, found := d.config.Model.MachineMap[bundleMachineID]
 	if !found {
@@ -240,6 +462,14 @@ func (d *differ) toModelMachineID(bundleMachineID string) string {
 	return result
 }
 
+// isPeerRelation reports whether the model relation is a peer relation,
+// relating an endpoint of an application to itself. Peer relations are
+// established by Juju: bundles can't declare them and they can't be
+// removed.
+func isPeerRelation(relation Relation) bool {
+	return relation.App1 == relation.App2 && relation.Endpoint1 == relation.Endpoint2
+}
+
 func (d *differ) diffRelations() *RelationsDiff {
 	bundleSet := make(map[Relation]bool)
 	for _, relation := range d.config.Bundle.Relations {
@@ -249,6 +479,9 @@ func (d *differ) diffRelations() *RelationsDiff {
 	modelSet := make(map[Relation]bool)
 	var modelAdditions []Relation
 	for _, original := range d.config.Model.Relations {
+		if isPeerRelation(original) {
+			continue
+		}
 		relation := canonicalRelation(original)
 		modelSet[relation] = true
 		_, found := bundleSet[relation]
@@ -277,7 +510,7 @@ func (d *differ) diffRelations() *RelationsDiff {
 	}
 }
 
-func (d *differ) diffAnnotations(bundle, model map[string]string) map[string]StringDiff {
+func (d *differ) diffStringMaps(bundle, model map[string]string) map[string]StringDiff {
 	all := set.NewStrings()
 	for name := range bundle {
 		all.Add(name)
@@ -302,6 +535,55 @@ func (d *differ) diffAnnotations(bundle, model map[string]string) map[string]Str
 	return result
 }
 
+// diffBundleValues compares the values of the keys named in the bundle.
+// It is used for the application settings where anything the bundle doesn't
+// mention keeps its current value: storage directives, device constraints
+// and endpoint bindings.
+func (d *differ) diffBundleValues(bundle, model map[string]string) map[string]StringDiff {
+	result := make(map[string]StringDiff)
+	for name, bundleValue := range bundle {
+		modelValue := model[name]
+		if bundleValue != modelValue {
+			result[name] = StringDiff{
+				Bundle: bundleValue,
+				Model:  modelValue,
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func (d *differ) diffResources(bundle map[string]interface{}, model *Application) map[string]ResourceDiff {
+	if model.Resources == nil && model.LocalResources == nil {
+		// The resources of the application are not known.
+		return nil
+	}
+	result := make(map[string]ResourceDiff)
+	for name, bundleValue := range bundle {
+		// The model side holds either a revision or the path of an
+		// uploaded resource.
+		var modelValue interface{}
+		if revision, found := model.Resources[name]; found {
+			modelValue = revision
+		} else if path, found := model.LocalResources[name]; found {
+			modelValue = path
+		}
+		if !reflect.DeepEqual(bundleValue, modelValue) {
+			result[name] = ResourceDiff{
+				Bundle: bundleValue,
+				Model:  modelValue,
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
 func (d *differ) diffOptions(bundle, model map[string]interface{}) map[string]OptionDiff {
 	all := set.NewStrings()
 	for name := range bundle {
@@ -373,6 +655,14 @@ func (d *differ) diffStrings(bundle, model string) *StringDiff {
 	return &StringDiff{Bundle: bundle, Model: model}
 }
 
+// diffStringSets compares the strings regardless of their order.
+func (d *differ) diffStringSets(bundle, model []string) *StringsDiff {
+	if reflect.DeepEqual(set.NewStrings(bundle...).SortedValues(), set.NewStrings(model...).SortedValues()) {
+		return nil
+	}
+	return &StringsDiff{Bundle: bundle, Model: model}
+}
+
 func (d *differ) diffInts(bundle, model int) *IntDiff {
 	if bundle == model {
 		return nil
@@ -392,6 +682,8 @@ type BundleDiff struct {
 	Applications map[string]*ApplicationDiff `yaml:"applications,omitempty"`
 	Machines     map[string]*MachineDiff     `yaml:"machines,omitempty"`
 	Relations    *RelationsDiff              `yaml:"relations,omitempty"`
+	Offers       map[string]*OfferDiff       `yaml:"offers,omitempty"`
+	Saas         map[string]*SaasDiff        `yaml:"saas,omitempty"`
 }
 
 // Empty returns whether the compared bundle and model match (at least
@@ -399,7 +691,9 @@ type BundleDiff struct {
 func (d *BundleDiff) Empty() bool {
 	return len(d.Applications) == 0 &&
 		len(d.Machines) == 0 &&
-		d.Relations == nil
+		d.Relations == nil &&
+		len(d.Offers) == 0 &&
+		len(d.Saas) == 0
 }
 
 // ApplicationDiff stores differences between an application in a bundle and a model.
@@ -410,15 +704,18 @@ type ApplicationDiff struct {
 	Channel          *StringDiff                    `yaml:"channel,omitempty"`
 	Placement        *StringDiff                    `yaml:"placement,omitempty"`
 	NumUnits         *IntDiff                       `yaml:"num_units,omitempty"`
+	UnitPlacement    map[string]StringDiff          `yaml:"unit_placement,omitempty"`
 	Scale            *IntDiff                       `yaml:"scale,omitempty"`
 	Expose           *BoolDiff                      `yaml:"expose,omitempty"`
+	Trust            *BoolDiff                      `yaml:"trust,omitempty"`
 	ExposedEndpoints map[string]ExposedEndpointDiff `yaml:"exposed_endpoints,omitempty"`
 	Options          map[string]OptionDiff          `yaml:"options,omitempty"`
 	Annotations      map[string]StringDiff          `yaml:"annotations,omitempty"`
 	Constraints      *StringDiff                    `yaml:"constraints,omitempty"`
-
-	// TODO (bundlediff): resources, storage, devices, endpoint
-	// bindings
+	Storage          map[string]StringDiff          `yaml:"storage,omitempty"`
+	Devices          map[string]StringDiff          `yaml:"devices,omitempty"`
+	EndpointBindings map[string]StringDiff          `yaml:"bindings,omitempty"`
+	Resources        map[string]ResourceDiff        `yaml:"resources,omitempty"`
 }
 
 // Empty returns whether the compared bundle and model applications
@@ -430,12 +727,18 @@ func (d *ApplicationDiff) Empty() bool {
 		d.Channel == nil &&
 		d.Placement == nil &&
 		d.NumUnits == nil &&
+		len(d.UnitPlacement) == 0 &&
 		d.Scale == nil &&
 		d.Expose == nil &&
+		d.Trust == nil &&
 		len(d.ExposedEndpoints) == 0 &&
 		len(d.Options) == 0 &&
 		len(d.Annotations) == 0 &&
-		d.Constraints == nil
+		d.Constraints == nil &&
+		len(d.Storage) == 0 &&
+		len(d.Devices) == 0 &&
+		len(d.EndpointBindings) == 0 &&
+		len(d.Resources) == 0
 }
 
 // StringDiff stores different bundle and model values for some
@@ -445,6 +748,13 @@ type StringDiff struct {
 	Model  string `yaml:"model"`
 }
 
+// StringsDiff stores different bundle and model values for some list
+// of strings.
+type StringsDiff struct {
+	Bundle []string `yaml:"bundle"`
+	Model  []string `yaml:"model"`
+}
+
 // IntDiff stores different bundle and model values for some int.
 type IntDiff struct {
 	Bundle int `yaml:"bundle"`
@@ -464,18 +774,52 @@ type OptionDiff struct {
 	Model  interface{} `yaml:"model"`
 }
 
+// ResourceDiff stores different bundle and model values for a
+// resource, either a revision or the path of a local resource.
+type ResourceDiff struct {
+	Bundle interface{} `yaml:"bundle"`
+	Model  interface{} `yaml:"model"`
+}
+
 // MachineDiff stores differences between a machine in a bundle and a model.
 type MachineDiff struct {
-	Missing     DiffSide              `yaml:"missing,omitempty"`
-	Annotations map[string]StringDiff `yaml:"annotations,omitempty"`
-	Series      *StringDiff           `yaml:"series,omitempty"`
+	Missing       DiffSide              `yaml:"missing,omitempty"`
+	Annotations   map[string]StringDiff `yaml:"annotations,omitempty"`
+	Series        *StringDiff           `yaml:"series,omitempty"`
+	Constraints   *StringDiff           `yaml:"constraints,omitempty"`
+	ContainerType *StringDiff           `yaml:"container_type,omitempty"`
 }
 
 // Empty returns whether the compared bundle and model machines match.
 func (d *MachineDiff) Empty() bool {
 	return d.Missing == None &&
 		len(d.Annotations) == 0 &&
-		d.Series == nil
+		d.Series == nil &&
+		d.Constraints == nil &&
+		d.ContainerType == nil
+}
+
+// OfferDiff stores differences between an offer in a bundle and a model.
+type OfferDiff struct {
+	Missing     DiffSide              `yaml:"missing,omitempty"`
+	Application *StringDiff           `yaml:"application,omitempty"`
+	Endpoints   *StringsDiff          `yaml:"endpoints,omitempty"`
+	ACL         map[string]StringDiff `yaml:"acl,omitempty"`
+}
+
+// Empty returns whether the compared bundle and model offers match.
+func (d *OfferDiff) Empty() bool {
+	return d.Missing == None &&
+		d.Application == nil &&
+		d.Endpoints == nil &&
+		len(d.ACL) == 0
+}
+
+// SaasDiff stores differences between a saas entry in a bundle and a
+// remote application in a model.
+type SaasDiff struct {
+	Missing DiffSide    `yaml:"missing,omitempty"`
+	URL     *StringDiff `yaml:"url,omitempty"`
 }
 
 // RelationsDiff stores differences between relations in a bundle and
@@ -488,7 +832,8 @@ type RelationsDiff struct {
 // relationFromEndpoints returns a (canonicalised) Relation from a
 // [app1:ep1 app2:ep2] bundle relation.
 func relationFromEndpoints(relation []string) Relation {
-	relation = relation[:]
+	// Sort a copy so that the bundle relation is left untouched.
+	relation = append([]string(nil), relation...)
 	sort.Strings(relation)
 	parts1 := strings.SplitN(relation[0], ":", 2)
 	parts2 := strings.SplitN(relation[1], ":", 2)
@@ -4,9 +4,11 @@
 package bundlechanges_test
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/juju/charm/v9"
+	"github.com/juju/errors"
 	"github.com/juju/loggo"
 	jujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
@@ -421,6 +423,110 @@ func (s *diffSuite) TestApplicationNumUnits(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
+func (s *diffSuite) TestApplicationUnitPlacement(c *gc.C) {
+	bundleContent := `
+        applications:
+            memcached:
+                charm: cs:xenial/memcached-7
+                num_units: 2
+                to: [0, 1]
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 4
+                to: ["lxd:0", "1", "lxd:memcached/1", "new"]
+        machines:
+            0:
+            1:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"memcached": {
+				Name:  "memcached",
+				Charm: "cs:xenial/memcached-7",
+				Units: []bundlechanges.Unit{
+					{Name: "memcached/0", Machine: "3"},
+					{Name: "memcached/1", Machine: "4"},
+				},
+			},
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "5"},
+					{Name: "prometheus/1", Machine: "3/lxd/0"},
+					{Name: "prometheus/2", Machine: "4/kvm/0"},
+					{Name: "prometheus/3", Machine: "4"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"3": {ID: "3"},
+			"4": {ID: "4"},
+		},
+		MachineMap: map[string]string{
+			"0": "3",
+			"1": "4",
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				UnitPlacement: map[string]bundlechanges.StringDiff{
+					"prometheus/2": {
+						Bundle: "lxd:4",
+						Model:  "4/kvm/0",
+					},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationUnitPlacementInferred(c *gc.C) {
+	// Without a machine map, the bundle machines are inferred from the
+	// units of the application.
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 2
+                to: ["0", "lxd:1"]
+        machines:
+            0:
+            1:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "5"},
+					{Name: "prometheus/1", Machine: "6"},
+				},
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				UnitPlacement: map[string]bundlechanges.StringDiff{
+					"prometheus/1": {
+						Bundle: "lxd:6",
+						Model:  "6",
+					},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.MachineDiff{
+			"0": {Missing: "model"},
+			"1": {Missing: "model"},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
 func (s *diffSuite) TestApplicationScale(c *gc.C) {
 	bundleContent := `
         bundle: kubernetes
@@ -454,6 +560,72 @@ func (s *diffSuite) TestApplicationScale(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
+func (s *diffSuite) TestApplicationDevices(c *gc.C) {
+	bundleContent := `
+        bundle: kubernetes
+        applications:
+            tensorflow:
+                charm: cs:tensorflow-3
+                scale: 1
+                devices:
+                    bitcoinminer: 2,nvidia.com/gpu
+                    tpu: 1,google.com/tpu
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"tensorflow": {
+				Name:   "tensorflow",
+				Series: "kubernetes",
+				Charm:  "cs:tensorflow-3",
+				Scale:  1,
+				Devices: map[string]string{
+					"bitcoinminer": "1,nvidia.com/gpu",
+				},
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"tensorflow": {
+				Devices: map[string]bundlechanges.StringDiff{
+					"bitcoinminer": {
+						Bundle: "2,nvidia.com/gpu",
+						Model:  "1,nvidia.com/gpu",
+					},
+					"tpu": {
+						Bundle: "1,google.com/tpu",
+						Model:  "",
+					},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationDevicesUnknown(c *gc.C) {
+	bundleContent := `
+        bundle: kubernetes
+        applications:
+            tensorflow:
+                charm: cs:tensorflow-3
+                scale: 1
+                devices:
+                    gpu: 1,nvidia.com/gpu
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"tensorflow": {
+				Name:   "tensorflow",
+				Series: "kubernetes",
+				Charm:  "cs:tensorflow-3",
+				Scale:  1,
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
 func (s *diffSuite) TestApplicationSubordinateNumUnits(c *gc.C) {
 	bundleContent := `
         applications:
@@ -546,14 +718,16 @@ func (s *diffSuite) TestApplicationConstraints(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestBundleSeries(c *gc.C) {
+func (s *diffSuite) TestApplicationStorage(c *gc.C) {
 	bundleContent := `
-        series: focal
         applications:
             prometheus:
-                charm: cs:focal/prometheus-7
+                charm: cs:xenial/prometheus-7
                 num_units: 1
-                constraints: something
+                storage:
+                    data: ebs,20G
+                    logs: ebs,1G
+                    metrics: tmpfs,1G
                 to: [0]
         machines:
             0:
@@ -561,33 +735,49 @@ func (s *diffSuite) TestBundleSeries(c *gc.C) {
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
-				Name:        "prometheus",
-				Charm:       "cs:focal/prometheus-7",
-				Series:      "focal",
-				Constraints: "something",
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Storage: map[string]string{
+					"data":    "ebs,10G",
+					"logs":    "ebs,1G",
+					"backups": "ebs,100G",
+				},
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
-			"0": {
-				ID:     "0",
-				Series: "focal",
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Storage: map[string]bundlechanges.StringDiff{
+					"data": {
+						Bundle: "ebs,20G",
+						Model:  "ebs,10G",
+					},
+					"metrics": {
+						Bundle: "tmpfs,1G",
+						Model:  "",
+					},
+				},
 			},
 		},
 	}
-	expectedDiff := &bundlechanges.BundleDiff{}
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestNoBundleSeries(c *gc.C) {
+func (s *diffSuite) TestApplicationStorageUnknown(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
-                charm: cs:focal/prometheus-7
+                charm: cs:xenial/prometheus-7
                 num_units: 1
-                constraints: something
+                storage:
+                    data: ebs,10G
                 to: [0]
         machines:
             0:
@@ -595,36 +785,65 @@ func (s *diffSuite) TestNoBundleSeries(c *gc.C) {
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
-				Name:        "prometheus",
-				Charm:       "cs:focal/prometheus-7",
-				Series:      "focal",
-				Constraints: "something",
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
-			"0": {
-				ID:     "0",
-				Series: "focal",
-			},
+			"0": {ID: "0"},
 		},
 	}
-	expectedDiff := &bundlechanges.BundleDiff{
-		Applications: map[string]*bundlechanges.ApplicationDiff{
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestApplicationEndpointBindings(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                bindings:
+                    "": alpha
+                    website: public
+                    target: internal
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
-				Series: &bundlechanges.StringDiff{
-					Bundle: "",
-					Model:  "focal",
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				EndpointBindings: map[string]string{
+					"":        "alpha",
+					"website": "alpha",
+					"scrape":  "alpha",
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
 				},
 			},
 		},
-		Machines: map[string]*bundlechanges.MachineDiff{
-			"0": {
-				Series: &bundlechanges.StringDiff{
-					Bundle: "",
-					Model:  "focal",
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				EndpointBindings: map[string]bundlechanges.StringDiff{
+					"website": {
+						Bundle: "public",
+						Model:  "alpha",
+					},
+					"target": {
+						Bundle: "internal",
+						Model:  "",
+					},
 				},
 			},
 		},
@@ -632,16 +851,17 @@ func (s *diffSuite) TestNoBundleSeries(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestApplicationOptions(c *gc.C) {
+func (s *diffSuite) TestApplicationResources(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
                 num_units: 1
-                options:
-                    griffin: [shoes, undies]
-                    travis: glasses
-                    clint: hat
+                resources:
+                    core: 3
+                    config: ./config.tar
+                    dashboards: 1
+                    rules: ./rules.tar
                 to: [0]
         machines:
             0:
@@ -649,12 +869,11 @@ func (s *diffSuite) TestApplicationOptions(c *gc.C) {
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
-				Name:  "prometheus",
-				Charm: "cs:xenial/prometheus-7",
-				Options: map[string]interface{}{
-					"griffin": []interface{}{"shoes", "undies"},
-					"justin":  "tshirt",
-					"clint":   "scarf",
+				Name:      "prometheus",
+				Charm:     "cs:xenial/prometheus-7",
+				Resources: map[string]int{"core": 2, "dashboards": 1},
+				LocalResources: map[string]string{
+					"config": "./config.tar",
 				},
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
@@ -668,10 +887,15 @@ func (s *diffSuite) TestApplicationOptions(c *gc.C) {
 	expectedDiff := &bundlechanges.BundleDiff{
 		Applications: map[string]*bundlechanges.ApplicationDiff{
 			"prometheus": {
-				Options: map[string]bundlechanges.OptionDiff{
-					"travis": {"glasses", nil},
-					"justin": {nil, "tshirt"},
-					"clint":  {"hat", "scarf"},
+				Resources: map[string]bundlechanges.ResourceDiff{
+					"core": {
+						Bundle: 3,
+						Model:  2,
+					},
+					"rules": {
+						Bundle: "./rules.tar",
+						Model:  nil,
+					},
 				},
 			},
 		},
@@ -679,61 +903,719 @@ func (s *diffSuite) TestApplicationOptions(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestApplicationAnnotations(c *gc.C) {
+func (s *diffSuite) TestApplicationResourcesUnknown(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
                 num_units: 1
-                annotations:
-                    griffin: shoes
-                    travis: glasses
+                resources:
+                    core: 3
+                    rules: ./rules.tar
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestBundleSeries(c *gc.C) {
+	bundleContent := `
+        series: focal
+        applications:
+            prometheus:
+                charm: cs:focal/prometheus-7
+                num_units: 1
+                constraints: something
                 to: [0]
         machines:
             0:
             `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:        "prometheus",
+				Charm:       "cs:focal/prometheus-7",
+				Series:      "focal",
+				Constraints: "something",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {
+				ID:     "0",
+				Series: "focal",
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestNoBundleSeries(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:focal/prometheus-7
+                num_units: 1
+                constraints: something
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:        "prometheus",
+				Charm:       "cs:focal/prometheus-7",
+				Series:      "focal",
+				Constraints: "something",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {
+				ID:     "0",
+				Series: "focal",
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Series: &bundlechanges.StringDiff{
+					Bundle: "",
+					Model:  "focal",
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.MachineDiff{
+			"0": {
+				Series: &bundlechanges.StringDiff{
+					Bundle: "",
+					Model:  "focal",
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationOptions(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                options:
+                    griffin: [shoes, undies]
+                    travis: glasses
+                    clint: hat
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Options: map[string]interface{}{
+					"griffin": []interface{}{"shoes", "undies"},
+					"justin":  "tshirt",
+					"clint":   "scarf",
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Options: map[string]bundlechanges.OptionDiff{
+					"travis": {"glasses", nil},
+					"justin": {nil, "tshirt"},
+					"clint":  {"hat", "scarf"},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationAnnotations(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                annotations:
+                    griffin: shoes
+                    travis: glasses
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Annotations: map[string]string{
+					"griffin": "shorts",
+					"justin":  "tshirt",
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Annotations: map[string]bundlechanges.StringDiff{
+					"griffin": {"shoes", "shorts"},
+					"travis":  {"glasses", ""},
+					"justin":  {"", "tshirt"},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationAnnotationsWithOptionOff(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                annotations:
+                    clint: hat
+                    griffin: shoes
+                    travis: glasses
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Annotations: map[string]string{
+					"clint":   "hat",
+					"griffin": "shorts",
+					"justin":  "tshirt",
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{}
+	config := bundlechanges.DiffConfig{
+		Bundle:             s.readBundle(c, bundleContent),
+		Model:              model,
+		IncludeAnnotations: false,
+		Logger:             s.logger,
+	}
+	s.checkDiffImpl(c, config, expectedDiff, "")
+}
+
+func (s *diffSuite) TestApplicationExpose(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:    "prometheus",
+				Charm:   "cs:xenial/prometheus-7",
+				Exposed: true,
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Expose: &bundlechanges.BoolDiff{
+					Bundle: false,
+					Model:  true,
+				},
+				// Since the model specifies "expose:true", all
+				// endpoints are exposed to 0.0.0.0/0 and ::/0
+				// which will show up in the diff given that
+				// the bundle is *not* exposed.
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpointDiff{
+					"": {
+						Model: &bundlechanges.ExposedEndpointDiffEntry{
+							ExposeToCIDRs: []string{"0.0.0.0/0", "::/0"},
+						},
+					},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationEndpointBindingsUnknown(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                bindings:
+                    "": alpha
+                    target: internal
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestApplicationTrust(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                trust: true
+                to: [0]
+        machines:
+            0:
+            `
+	untrusted := false
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Trust: &untrusted,
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Trust: &bundlechanges.BoolDiff{
+					Bundle: true,
+					Model:  false,
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationTrustUnknown(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                trust: true
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestApplicationExposeImplicitCIDRs(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 1
+                expose: true
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:    "prometheus",
+				Charm:   "cs:xenial/prometheus-7",
+				Exposed: true,
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+					"": {
+						ExposeToCIDRs: []string{"10.0.0.0/24"},
+					},
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "prometheus/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				// Since the model specifies "expose:true", all
+				// endpoints are implicitly exposed to 0.0.0.0/0.
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpointDiff{
+					"": {
+						Bundle: &bundlechanges.ExposedEndpointDiffEntry{
+							// Implicit CIDRs as the bundle specifies "expose: true"
+							ExposeToCIDRs: []string{"0.0.0.0/0", "::/0"},
+						},
+						Model: &bundlechanges.ExposedEndpointDiffEntry{
+							ExposeToCIDRs: []string{"10.0.0.0/24"},
+						},
+					},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestApplicationPlacement(c *gc.C) {
+	bundleContent := `
+        bundle: kubernetes
+        applications:
+            prometheus:
+                charm: cs:prometheus-7
+                scale: 2
+                placement: foo=bar
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:      "prometheus",
+				Series:    "kubernetes",
+				Charm:     "cs:prometheus-7",
+				Scale:     2,
+				Placement: "foo=baz",
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Applications: map[string]*bundlechanges.ApplicationDiff{
+			"prometheus": {
+				Placement: &bundlechanges.StringDiff{
+					Bundle: "foo=bar",
+					Model:  "foo=baz",
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestOffers(c *gc.C) {
+	bundleContent := `
+applications:
+  prometheus:
+    charm: cs:xenial/prometheus-7
+    offers:
+      metrics:
+        endpoints:
+        - target
+        - scrape
+        acl:
+          admin: admin
+          bob: consume
+      dashboards:
+        endpoints:
+        - grafana-source
+      alerts:
+        endpoints:
+        - alertmanager
+  grafana:
+    charm: cs:xenial/grafana-3
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:   "prometheus",
+				Charm:  "cs:xenial/prometheus-7",
+				Offers: []string{"metrics", "dashboards"},
+				OfferEndpoints: map[string][]string{
+					"metrics":    {"scrape", "target"},
+					"dashboards": {"grafana-source", "website"},
+				},
+				OfferACLs: map[string]map[string]string{
+					"metrics": {
+						"admin": "admin",
+						"bob":   "read",
+						"alice": "consume",
+					},
+				},
+			},
+			"grafana": {
+				Name:   "grafana",
+				Charm:  "cs:xenial/grafana-3",
+				Offers: []string{"grafana"},
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Offers: map[string]*bundlechanges.OfferDiff{
+			"alerts": {
+				Missing: "model",
+			},
+			"dashboards": {
+				Endpoints: &bundlechanges.StringsDiff{
+					Bundle: []string{"grafana-source"},
+					Model:  []string{"grafana-source", "website"},
+				},
+			},
+			"grafana": {
+				Missing: "bundle",
+			},
+			"metrics": {
+				ACL: map[string]bundlechanges.StringDiff{
+					"alice": {
+						Bundle: "",
+						Model:  "consume",
+					},
+					"bob": {
+						Bundle: "consume",
+						Model:  "read",
+					},
+				},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestOffersWithoutEndpointsAndACLs(c *gc.C) {
+	bundleContent := `
+applications:
+  prometheus:
+    charm: cs:xenial/prometheus-7
+    offers:
+      metrics:
+        endpoints:
+        - target
+        acl:
+          admin: admin
+    `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:   "prometheus",
+				Charm:  "cs:xenial/prometheus-7",
+				Offers: []string{"metrics"},
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestSaas(c *gc.C) {
+	bundleContent := `
+        saas:
+            keystone:
+                url: production:admin/info.keystone
+            mysql:
+                url: production:admin/info.mysql
+            vault:
+                url: production:admin/info.vault
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+			},
+		},
+		RemoteApplications: map[string]*bundlechanges.RemoteApplication{
+			"keystone": {
+				Name:     "keystone",
+				OfferURL: "production:admin/info.keystone",
+			},
+			"mysql": {
+				Name:     "mysql",
+				OfferURL: "staging:admin/info.mysql",
+			},
+			"grafana": {
+				Name:     "grafana",
+				OfferURL: "production:admin/info.grafana",
+			},
+		},
+	}
+	expectedDiff := &bundlechanges.BundleDiff{
+		Saas: map[string]*bundlechanges.SaasDiff{
+			"grafana": {
+				Missing: "bundle",
+			},
+			"mysql": {
+				URL: &bundlechanges.StringDiff{
+					Bundle: "production:admin/info.mysql",
+					Model:  "staging:admin/info.mysql",
+				},
+			},
+			"vault": {
+				Missing: "model",
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, expectedDiff)
+}
+
+func (s *diffSuite) TestSaasUnknown(c *gc.C) {
+	bundleContent := `
+        saas:
+            keystone:
+                url: production:admin/info.keystone
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"prometheus": {
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
+			},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestModelMissingMachine(c *gc.C) {
+	bundleContent := `
+        applications:
+            prometheus:
+                charm: cs:xenial/prometheus-7
+                num_units: 2
+                to: [0, 1]
+        machines:
+            0:
+            1:
+            `
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
 				Name:  "prometheus",
 				Charm: "cs:xenial/prometheus-7",
-				Annotations: map[string]string{
-					"griffin": "shorts",
-					"justin":  "tshirt",
-				},
 				Units: []bundlechanges.Unit{
-					{Name: "prometheus/0", Machine: "0"},
+					{Name: "prometheus/0", Machine: "2"},
+					{Name: "prometheus/1", Machine: "2"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
-			"0": {ID: "0"},
+			"2": {ID: "2"},
+		},
+		MachineMap: map[string]string{
+			"0": "2",
 		},
 	}
 	expectedDiff := &bundlechanges.BundleDiff{
 		Applications: map[string]*bundlechanges.ApplicationDiff{
 			"prometheus": {
-				Annotations: map[string]bundlechanges.StringDiff{
-					"griffin": {"shoes", "shorts"},
-					"travis":  {"glasses", ""},
-					"justin":  {"", "tshirt"},
+				UnitPlacement: map[string]bundlechanges.StringDiff{
+					"prometheus/1": {
+						Bundle: "1",
+						Model:  "2",
+					},
 				},
 			},
 		},
+		Machines: map[string]*bundlechanges.MachineDiff{
+			"1": {Missing: "model"},
+		},
 	}
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestApplicationAnnotationsWithOptionOff(c *gc.C) {
+func (s *diffSuite) TestBundleMissingMachine(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
-                num_units: 1
-                annotations:
-                    clint: hat
-                    griffin: shoes
-                    travis: glasses
+                num_units: 2
                 to: [0]
         machines:
             0:
@@ -743,31 +1625,29 @@ func (s *diffSuite) TestApplicationAnnotationsWithOptionOff(c *gc.C) {
 			"prometheus": {
 				Name:  "prometheus",
 				Charm: "cs:xenial/prometheus-7",
-				Annotations: map[string]string{
-					"clint":   "hat",
-					"griffin": "shorts",
-					"justin":  "tshirt",
-				},
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
+					{Name: "prometheus/1", Machine: "1"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
 			"0": {ID: "0"},
+			"1": {ID: "1"},
+		},
+		MachineMap: map[string]string{
+			"0": "1",
 		},
 	}
-	expectedDiff := &bundlechanges.BundleDiff{}
-	config := bundlechanges.DiffConfig{
-		Bundle:             s.readBundle(c, bundleContent),
-		Model:              model,
-		IncludeAnnotations: false,
-		Logger:             s.logger,
+	expectedDiff := &bundlechanges.BundleDiff{
+		Machines: map[string]*bundlechanges.MachineDiff{
+			"0": {Missing: "bundle"},
+		},
 	}
-	s.checkDiffImpl(c, config, expectedDiff, "")
+	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestApplicationExpose(c *gc.C) {
+func (s *diffSuite) TestMachineSeries(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
@@ -776,39 +1656,31 @@ func (s *diffSuite) TestApplicationExpose(c *gc.C) {
                 to: [0]
         machines:
             0:
+                series: bionic
             `
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
-				Name:    "prometheus",
-				Charm:   "cs:xenial/prometheus-7",
-				Exposed: true,
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
-			"0": {ID: "0"},
+			"0": {
+				ID:     "0",
+				Series: "xenial",
+			},
 		},
 	}
 	expectedDiff := &bundlechanges.BundleDiff{
-		Applications: map[string]*bundlechanges.ApplicationDiff{
-			"prometheus": {
-				Expose: &bundlechanges.BoolDiff{
-					Bundle: false,
-					Model:  true,
-				},
-				// Since the model specifies "expose:true", all
-				// endpoints are exposed to 0.0.0.0/0 and ::/0
-				// which will show up in the diff given that
-				// the bundle is *not* exposed.
-				ExposedEndpoints: map[string]bundlechanges.ExposedEndpointDiff{
-					"": {
-						Model: &bundlechanges.ExposedEndpointDiffEntry{
-							ExposeToCIDRs: []string{"0.0.0.0/0", "::/0"},
-						},
-					},
+		Machines: map[string]*bundlechanges.MachineDiff{
+			"0": {
+				Series: &bundlechanges.StringDiff{
+					Bundle: "bionic",
+					Model:  "xenial",
 				},
 			},
 		},
@@ -816,102 +1688,80 @@ func (s *diffSuite) TestApplicationExpose(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestApplicationExposeImplicitCIDRs(c *gc.C) {
+func (s *diffSuite) TestMachineConstraints(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
-                num_units: 1
-                expose: true
-                to: [0]
+                num_units: 2
+                to: [0, 1]
         machines:
             0:
+                constraints: mem=4G cores=2
+            1:
+                constraints: mem=8G
             `
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
-				Name:    "prometheus",
-				Charm:   "cs:xenial/prometheus-7",
-				Exposed: true,
-				ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
-					"": {
-						ExposeToCIDRs: []string{"10.0.0.0/24"},
-					},
-				},
+				Name:  "prometheus",
+				Charm: "cs:xenial/prometheus-7",
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
+					{Name: "prometheus/1", Machine: "1"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
-			"0": {ID: "0"},
+			"0": {
+				ID:          "0",
+				Constraints: "cores=2 mem=4G",
+			},
+			"1": {
+				ID:          "1",
+				Constraints: "mem=4G",
+			},
 		},
 	}
 	expectedDiff := &bundlechanges.BundleDiff{
-		Applications: map[string]*bundlechanges.ApplicationDiff{
-			"prometheus": {
-				// Since the model specifies "expose:true", all
-				// endpoints are implicitly exposed to 0.0.0.0/0.
-				ExposedEndpoints: map[string]bundlechanges.ExposedEndpointDiff{
-					"": {
-						Bundle: &bundlechanges.ExposedEndpointDiffEntry{
-							// Implicit CIDRs as the bundle specifies "expose: true"
-							ExposeToCIDRs: []string{"0.0.0.0/0", "::/0"},
-						},
-						Model: &bundlechanges.ExposedEndpointDiffEntry{
-							ExposeToCIDRs: []string{"10.0.0.0/24"},
-						},
-					},
+		Machines: map[string]*bundlechanges.MachineDiff{
+			"0": {
+				Constraints: &bundlechanges.StringDiff{
+					Bundle: "mem=4G cores=2",
+					Model:  "cores=2 mem=4G",
+				},
+			},
+			"1": {
+				Constraints: &bundlechanges.StringDiff{
+					Bundle: "mem=8G",
+					Model:  "mem=4G",
 				},
 			},
 		},
 	}
 	s.checkDiff(c, bundleContent, model, expectedDiff)
-}
 
-func (s *diffSuite) TestApplicationPlacement(c *gc.C) {
-	bundleContent := `
-        bundle: kubernetes
-        applications:
-            prometheus:
-                charm: cs:prometheus-7
-                scale: 2
-                placement: foo=bar
-            `
-	model := &bundlechanges.Model{
-		Applications: map[string]*bundlechanges.Application{
-			"prometheus": {
-				Name:      "prometheus",
-				Series:    "kubernetes",
-				Charm:     "cs:prometheus-7",
-				Scale:     2,
-				Placement: "foo=baz",
-			},
-		},
-	}
-	expectedDiff := &bundlechanges.BundleDiff{
-		Applications: map[string]*bundlechanges.ApplicationDiff{
-			"prometheus": {
-				Placement: &bundlechanges.StringDiff{
-					Bundle: "foo=bar",
-					Model:  "foo=baz",
-				},
-			},
-		},
+	// With a way to compare constraints, only the real differences are
+	// reported.
+	model.ConstraintsEqual = func(a, b string) bool {
+		fieldsA, fieldsB := strings.Fields(a), strings.Fields(b)
+		sort.Strings(fieldsA)
+		sort.Strings(fieldsB)
+		return strings.Join(fieldsA, " ") == strings.Join(fieldsB, " ")
 	}
+	delete(expectedDiff.Machines, "0")
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestModelMissingMachine(c *gc.C) {
+func (s *diffSuite) TestMachineContainerType(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
-                num_units: 2
-                to: [0, 1]
+                num_units: 1
+                to: [0]
         machines:
             0:
-            1:
             `
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
@@ -919,35 +1769,51 @@ func (s *diffSuite) TestModelMissingMachine(c *gc.C) {
 				Name:  "prometheus",
 				Charm: "cs:xenial/prometheus-7",
 				Units: []bundlechanges.Unit{
-					{Name: "prometheus/0", Machine: "2"},
-					{Name: "prometheus/1", Machine: "2"},
+					{Name: "prometheus/0", Machine: "2/lxd/0"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
-			"2": {ID: "2"},
+			"2/lxd/0": {
+				ID:            "2/lxd/0",
+				ContainerType: "lxd",
+				ParentID:      "2",
+			},
 		},
 		MachineMap: map[string]string{
-			"0": "2",
+			"0": "2/lxd/0",
 		},
 	}
 	expectedDiff := &bundlechanges.BundleDiff{
 		Machines: map[string]*bundlechanges.MachineDiff{
-			"1": {Missing: "model"},
+			"2/lxd/0": {
+				ContainerType: &bundlechanges.StringDiff{
+					Bundle: "",
+					Model:  "lxd",
+				},
+			},
 		},
 	}
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
-func (s *diffSuite) TestBundleMissingMachine(c *gc.C) {
+func (s *diffSuite) TestUnknownSpaces(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
-                num_units: 2
+                num_units: 1
+                constraints: spaces=alpha,^dmz
+                bindings:
+                    "": alpha
+                    target: internal
+                exposed-endpoints:
+                    website:
+                        expose-to-spaces: [alpha, public]
                 to: [0]
         machines:
             0:
+                constraints: spaces=storage
             `
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
@@ -956,65 +1822,68 @@ func (s *diffSuite) TestBundleMissingMachine(c *gc.C) {
 				Charm: "cs:xenial/prometheus-7",
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
-					{Name: "prometheus/1", Machine: "1"},
 				},
 			},
 		},
 		Machines: map[string]*bundlechanges.Machine{
 			"0": {ID: "0"},
-			"1": {ID: "1"},
 		},
-		MachineMap: map[string]string{
-			"0": "1",
+		Spaces: map[string]*bundlechanges.Space{
+			"alpha": {Name: "alpha", Subnets: []string{"10.0.0.0/24"}},
 		},
 	}
-	expectedDiff := &bundlechanges.BundleDiff{
-		Machines: map[string]*bundlechanges.MachineDiff{
-			"0": {Missing: "bundle"},
-		},
+	config := bundlechanges.DiffConfig{
+		Bundle: s.readBundle(c, bundleContent),
+		Model:  model,
+		Logger: s.logger,
 	}
-	s.checkDiff(c, bundleContent, model, expectedDiff)
+	diff, err := bundlechanges.BuildDiff(config)
+	c.Assert(diff, gc.IsNil)
+	c.Assert(err, gc.ErrorMatches, `bundle refers to unknown spaces: `+
+		`space "internal" in binding of endpoint "target" of application "prometheus", `+
+		`space "public" in expose of endpoint "website" of application "prometheus", `+
+		`space "dmz" in constraints of application "prometheus", `+
+		`space "storage" in constraints of machine "0"`)
+	spacesErr, ok := errors.Cause(err).(*bundlechanges.UnknownSpacesError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(spacesErr.References, jc.DeepEquals, []bundlechanges.SpaceReference{
+		{Space: "internal", Application: "prometheus", Usage: "binding", Endpoint: "target"},
+		{Space: "public", Application: "prometheus", Usage: "expose", Endpoint: "website"},
+		{Space: "dmz", Application: "prometheus", Usage: "constraints"},
+		{Space: "storage", Machine: "0", Usage: "constraints"},
+	})
 }
 
-func (s *diffSuite) TestMachineSeries(c *gc.C) {
+func (s *diffSuite) TestKnownSpaces(c *gc.C) {
 	bundleContent := `
         applications:
             prometheus:
                 charm: cs:xenial/prometheus-7
                 num_units: 1
-                to: [0]
-        machines:
-            0:
-                series: bionic
+                bindings:
+                    "": alpha
+                    target: internal
             `
 	model := &bundlechanges.Model{
 		Applications: map[string]*bundlechanges.Application{
 			"prometheus": {
 				Name:  "prometheus",
 				Charm: "cs:xenial/prometheus-7",
+				EndpointBindings: map[string]string{
+					"":       "alpha",
+					"target": "internal",
+				},
 				Units: []bundlechanges.Unit{
 					{Name: "prometheus/0", Machine: "0"},
 				},
 			},
 		},
-		Machines: map[string]*bundlechanges.Machine{
-			"0": {
-				ID:     "0",
-				Series: "xenial",
-			},
-		},
-	}
-	expectedDiff := &bundlechanges.BundleDiff{
-		Machines: map[string]*bundlechanges.MachineDiff{
-			"0": {
-				Series: &bundlechanges.StringDiff{
-					Bundle: "bionic",
-					Model:  "xenial",
-				},
-			},
+		Spaces: map[string]*bundlechanges.Space{
+			"alpha":    {Name: "alpha"},
+			"internal": {Name: "internal"},
 		},
 	}
-	s.checkDiff(c, bundleContent, model, expectedDiff)
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
 }
 
 func (s *diffSuite) TestMachineAnnotations(c *gc.C) {
@@ -1176,6 +2045,67 @@ func (s *diffSuite) TestRelations(c *gc.C) {
 	s.checkDiff(c, bundleContent, model, expectedDiff)
 }
 
+func (s *diffSuite) TestPeerRelationsIgnored(c *gc.C) {
+	bundleContent := `
+        applications:
+            mysql:
+                charm: cs:xenial/mysql-7
+                num_units: 1
+                to: [0]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"mysql": {
+				Name:  "mysql",
+				Charm: "cs:xenial/mysql-7",
+				Units: []bundlechanges.Unit{
+					{Name: "mysql/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+		},
+		Relations: []bundlechanges.Relation{{
+			App1:      "mysql",
+			Endpoint1: "cluster",
+			App2:      "mysql",
+			Endpoint2: "cluster",
+		}},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
+func (s *diffSuite) TestContainersNotReportedMissing(c *gc.C) {
+	bundleContent := `
+        applications:
+            memcached:
+                charm: cs:xenial/memcached-7
+                num_units: 1
+                to: ["lxd:0"]
+        machines:
+            0:
+            `
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"memcached": {
+				Name:  "memcached",
+				Charm: "cs:xenial/memcached-7",
+				Units: []bundlechanges.Unit{
+					{Name: "memcached/0", Machine: "0/lxd/0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0":       {ID: "0"},
+			"0/lxd/0": {ID: "0/lxd/0"},
+		},
+	}
+	s.checkDiff(c, bundleContent, model, &bundlechanges.BundleDiff{})
+}
+
 func (s *diffSuite) TestRelationsWithMissingEndpoints(c *gc.C) {
 	bundleContent := `
         applications:
@@ -0,0 +1,276 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Backend applies changes to a model. There is one method for each kind of
+// change, called with the parameters of the change once the placeholders
+// they hold are replaced with the results of the changes they refer to.
+type Backend interface {
+	// AddCharm adds a charm to the model and returns its URL.
+	AddCharm(params AddCharmParams) (string, error)
+	UpgradeCharm(params UpgradeCharmParams) error
+	// AddApplication deploys an application and returns its name.
+	AddApplication(params AddApplicationParams) (string, error)
+	// AddMachine adds a machine or a container and returns its id.
+	AddMachine(params AddMachineParams) (string, error)
+	// AddUnit adds a unit and returns its name and the id of its machine.
+	AddUnit(params AddUnitParams) (unit string, machine string, err error)
+	AddRelation(params AddRelationParams) error
+	Expose(params ExposeParams) error
+	Unexpose(params UnexposeParams) error
+	Scale(params ScaleParams) error
+	SetAnnotations(params SetAnnotationsParams) error
+	SetOptions(params SetOptionsParams) error
+	SetConstraints(params SetConstraintsParams) error
+	AddStorage(params AddStorageParams) error
+	Bind(params BindParams) error
+	SetTrust(params SetTrustParams) error
+	CreateOffer(params CreateOfferParams) error
+	// ConsumeOffer consumes an offer and returns the name of the remote
+	// application.
+	ConsumeOffer(params ConsumeOfferParams) (string, error)
+	GrantOfferAccess(params GrantOfferAccessParams) error
+	RevokeOfferAccess(params RevokeOfferAccessParams) error
+	RemoveOffer(params RemoveOfferParams) error
+	RemoveApplication(params RemoveApplicationParams) error
+	RemoveUnit(params RemoveUnitParams) error
+	RemoveMachine(params RemoveMachineParams) error
+	RemoveRelation(params RemoveRelationParams) error
+}
+
+// ExecutorConfig holds the configuration of an Executor.
+type ExecutorConfig struct {
+	Backend Backend
+	Logger  Logger
+	// Parallel is the maximum number of changes applied concurrently. The
+	// changes are applied one at a time when it is not greater than one.
+	Parallel int
+	// Limits holds the maximum number of changes applied concurrently by
+	// change method. See Waves.
+	Limits map[string]int
+	// Journal, if not nil, records the outcome of the applied changes. The
+	// changes it records as applied are skipped, so that a plan can be
+	// resumed after a failure.
+	Journal *Journal
+}
+
+// Validate returns an error if the config is not valid.
+func (c ExecutorConfig) Validate() error {
+	if c.Backend == nil {
+		return errors.NotValidf("nil Backend")
+	}
+	if c.Logger == nil {
+		return errors.NotValidf("nil Logger")
+	}
+	return nil
+}
+
+// Executor applies the changes of a plan through a backend.
+type Executor struct {
+	config ExecutorConfig
+}
+
+// NewExecutor returns an executor with the given configuration.
+func NewExecutor(config ExecutorConfig) (*Executor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Executor{config: config}, nil
+}
+
+// Execute applies the changes in dependency order, and returns the results
+// of the applied changes keyed by change id: the charm URLs, application
+// names, machine ids and unit names. When a change fails, the changes
+// already started are completed, no other change is applied, and the
+// results so far are returned with the error. The results include those of
+// the changes applied in previous runs recorded by the journal.
+func (e *Executor) Execute(changes []Change) (map[string]string, error) {
+	limits := e.config.Limits
+	if e.config.Parallel <= 1 {
+		limits = nil
+	}
+	waves, err := Waves(changes, limits)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	run := &execution{
+		backend:  e.config.Backend,
+		resolver: NewResolver(),
+		journal:  e.config.Journal,
+	}
+	if run.journal != nil {
+		run.journal.Restore(run.resolver)
+	}
+	for _, wave := range waves {
+		if err := e.executeWave(run, wave); err != nil {
+			return run.resolver.Results(), errors.Trace(err)
+		}
+	}
+	return run.resolver.Results(), nil
+}
+
+// executeWave applies the changes of the wave, which don't depend on each
+// other, and returns the error of the first change in the wave that failed.
+// The changes of the wave not started when a change fails are not applied.
+func (e *Executor) executeWave(run *execution, wave []Change) error {
+	parallel := e.config.Parallel
+	if parallel <= 1 {
+		for _, change := range wave {
+			if err := e.apply(run, change); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, len(wave))
+	sem := make(chan struct{}, parallel)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for i, change := range wave {
+		sem <- struct{}{}
+		// No other change is started once a change failed.
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, change Change) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := e.apply(run, change); err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				errs[i] = err
+			}
+		}(i, change)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Executor) apply(run *execution, change Change) error {
+	id := change.Id()
+	if run.journal != nil && run.journal.Applied(id) {
+		e.config.Logger.Tracef("skipping %s: already applied", id)
+		return nil
+	}
+	e.config.Logger.Tracef("applying %s: %s", id, strings.Join(change.Description(), ", "))
+	result, machine, err := run.apply(change)
+	if err != nil {
+		err = errors.Annotatef(err, "cannot apply change %q", id)
+		if run.journal != nil {
+			entry := JournalEntry{Change: id, Status: ChangeFailed, Error: err.Error()}
+			if jerr := run.journal.Record(entry); jerr != nil {
+				e.config.Logger.Tracef("%v", jerr)
+			}
+		}
+		return err
+	}
+	switch {
+	case machine != "":
+		run.resolver.RecordUnit(id, result, machine)
+	case result != "":
+		run.resolver.Record(id, result)
+	}
+	if run.journal != nil {
+		entry := JournalEntry{Change: id, Status: ChangeApplied, Result: result, Machine: machine}
+		if err := run.journal.Record(entry); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// execution applies changes through a backend.
+type execution struct {
+	backend  Backend
+	resolver *Resolver
+	journal  *Journal
+}
+
+// apply resolves the placeholders of the change and applies it. It returns
+// the result of the change, and the machine of the unit added by an
+// addUnit change.
+func (run *execution) apply(change Change) (result, machine string, err error) {
+	resolved, err := run.resolver.Resolve(change)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	b := run.backend
+	switch change := resolved.(type) {
+	case *AddCharmChange:
+		result, err = b.AddCharm(change.Params)
+	case *UpgradeCharmChange:
+		err = b.UpgradeCharm(change.Params)
+	case *AddApplicationChange:
+		result, err = b.AddApplication(change.Params)
+	case *AddMachineChange:
+		result, err = b.AddMachine(change.Params)
+	case *AddUnitChange:
+		result, machine, err = b.AddUnit(change.Params)
+	case *AddRelationChange:
+		err = b.AddRelation(change.Params)
+	case *ExposeChange:
+		err = b.Expose(change.Params)
+	case *UnexposeChange:
+		err = b.Unexpose(change.Params)
+	case *ScaleChange:
+		err = b.Scale(change.Params)
+	case *SetAnnotationsChange:
+		err = b.SetAnnotations(change.Params)
+	case *SetOptionsChange:
+		err = b.SetOptions(change.Params)
+	case *SetConstraintsChange:
+		err = b.SetConstraints(change.Params)
+	case *AddStorageChange:
+		err = b.AddStorage(change.Params)
+	case *BindChange:
+		err = b.Bind(change.Params)
+	case *SetTrustChange:
+		err = b.SetTrust(change.Params)
+	case *CreateOfferChange:
+		err = b.CreateOffer(change.Params)
+	case *ConsumeOfferChange:
+		result, err = b.ConsumeOffer(change.Params)
+	case *GrantOfferAccessChange:
+		err = b.GrantOfferAccess(change.Params)
+	case *RevokeOfferAccessChange:
+		err = b.RevokeOfferAccess(change.Params)
+	case *RemoveOfferChange:
+		err = b.RemoveOffer(change.Params)
+	case *RemoveApplicationChange:
+		err = b.RemoveApplication(change.Params)
+	case *RemoveUnitChange:
+		err = b.RemoveUnit(change.Params)
+	case *RemoveMachineChange:
+		err = b.RemoveMachine(change.Params)
+	case *RemoveRelationChange:
+		err = b.RemoveRelation(change.Params)
+	default:
+		return "", "", errors.NotSupportedf("change %T", change)
+	}
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return result, machine, nil
+}
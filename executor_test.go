@@ -0,0 +1,218 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/juju/charm/v9"
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/bundlechanges/v5"
+)
+
+type executorSuite struct{}
+
+var _ = gc.Suite(&executorSuite{})
+
+const executorBundle = `
+applications:
+    django:
+        charm: cs:django-4
+        series: bionic
+        num_units: 2
+        to: ["0", "lxd:0"]
+        expose: true
+        annotations:
+            gui-x: "10"
+    mysql:
+        charm: cs:mysql-58
+        series: bionic
+        num_units: 1
+        to: ["django/0"]
+machines:
+    "0":
+        series: bionic
+        annotations:
+            foo: bar
+relations:
+    - - django:db
+      - mysql:db
+`
+
+// bundlePlan returns the bundle data and the changes to deploy it to the
+// given model, which may be nil.
+func bundlePlan(c *gc.C, bundle string, model *bundlechanges.Model) (*charm.BundleData, []bundlechanges.Change) {
+	data, err := charm.ReadBundleData(strings.NewReader(bundle))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Verify(nil, nil, nil), jc.ErrorIsNil)
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model:  model,
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return data, changes
+}
+
+func (s *executorSuite) execute(c *gc.C, parallel int) {
+	data, changes := bundlePlan(c, executorBundle, nil)
+	backend := bundlechanges.NewFakeBackend(nil)
+	executor, err := bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Backend:  backend,
+		Logger:   loggo.GetLogger("bundlechanges"),
+		Parallel: parallel,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	results, err := executor.Execute(changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(backend.Calls(), gc.HasLen, len(changes))
+
+	for _, change := range changes {
+		switch change := change.(type) {
+		case *bundlechanges.AddCharmChange:
+			c.Check(results[change.Id()], gc.Equals, change.Params.Charm)
+		case *bundlechanges.AddApplicationChange:
+			c.Check(results[change.Id()], gc.Equals, change.Params.Application)
+		case *bundlechanges.AddMachineChange, *bundlechanges.AddUnitChange:
+			c.Check(results[change.Id()], gc.Not(gc.Equals), "")
+		}
+	}
+	model := backend.Model()
+	c.Check(model.Applications["django"].Units, jc.DeepEquals, []bundlechanges.Unit{
+		{Name: "django/0", Machine: "0"},
+		{Name: "django/1", Machine: "0/lxd/0"},
+	})
+	c.Check(model.Applications["mysql"].Units, jc.DeepEquals, []bundlechanges.Unit{
+		{Name: "mysql/0", Machine: "0"},
+	})
+	c.Check(model.Relations, jc.DeepEquals, []bundlechanges.Relation{
+		{App1: "django", Endpoint1: "db", App2: "mysql", Endpoint2: "db"},
+	})
+
+	// The model now matches the bundle.
+	diff, err := bundlechanges.BuildDiff(bundlechanges.DiffConfig{
+		Bundle:             data,
+		Model:              model,
+		IncludeAnnotations: true,
+		Logger:             loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(diff.Empty(), jc.IsTrue, gc.Commentf("diff: %#v", diff))
+}
+
+func (s *executorSuite) TestExecute(c *gc.C) {
+	s.execute(c, 0)
+}
+
+func (s *executorSuite) TestExecuteParallel(c *gc.C) {
+	s.execute(c, 4)
+}
+
+// slowCharmBackend is a backend whose charms take a while to be added.
+type slowCharmBackend struct {
+	*bundlechanges.FakeBackend
+}
+
+func (b slowCharmBackend) AddCharm(params bundlechanges.AddCharmParams) (string, error) {
+	time.Sleep(20 * time.Millisecond)
+	return b.FakeBackend.AddCharm(params)
+}
+
+func (s *executorSuite) TestExecuteParallelUpgrade(c *gc.C) {
+	model := func() *bundlechanges.Model {
+		return &bundlechanges.Model{
+			Applications: map[string]*bundlechanges.Application{
+				"django": {Name: "django", Charm: "cs:django-4"},
+			},
+		}
+	}
+	data, changes := bundlePlan(c, `
+applications:
+    django:
+        charm: cs:django-5
+        options:
+            debug: true
+        expose: true
+`, model())
+	// The changes to the application wait for the charm upgrade, which
+	// waits for the charm to be added.
+	backend := bundlechanges.NewFakeBackend(model())
+	executor, err := bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Backend:  slowCharmBackend{backend},
+		Logger:   loggo.GetLogger("bundlechanges"),
+		Parallel: 4,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = executor.Execute(changes)
+	c.Assert(err, jc.ErrorIsNil)
+	var methods []string
+	for _, call := range backend.Calls() {
+		methods = append(methods, call.Method)
+	}
+	c.Check(methods[:2], jc.DeepEquals, []string{"AddCharm", "UpgradeCharm"})
+	c.Check(methods, gc.HasLen, len(changes))
+
+	diff, err := bundlechanges.BuildDiff(bundlechanges.DiffConfig{
+		Bundle: data,
+		Model:  backend.Model(),
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(diff.Empty(), jc.IsTrue, gc.Commentf("diff: %#v", diff))
+}
+
+func (s *executorSuite) TestExecuteFailure(c *gc.C) {
+	_, changes := bundlePlan(c, executorBundle, nil)
+	backend := bundlechanges.NewFakeBackend(nil)
+	backend.SetError("AddRelation", errors.New("boom"))
+	executor, err := bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Backend: backend,
+		Logger:  loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	results, err := executor.Execute(changes)
+	c.Assert(err, gc.ErrorMatches, `cannot apply change "addRelation-[0-9]+": boom`)
+	// The changes applied before the failure keep their results.
+	c.Check(results["addCharm-0"], gc.Equals, "cs:django-4")
+	last := backend.Calls()[len(backend.Calls())-1]
+	c.Check(last.Method, gc.Equals, "AddRelation")
+	params := last.Params.(bundlechanges.AddRelationParams)
+	c.Check(params.Endpoint1, gc.Equals, "django:db")
+	c.Check(params.Endpoint2, gc.Equals, "mysql:db")
+}
+
+func (s *executorSuite) TestExecuteParallelFailure(c *gc.C) {
+	_, changes := bundlePlan(c, executorBundle, nil)
+	backend := bundlechanges.NewFakeBackend(nil)
+	backend.SetError("AddCharm", errors.New("boom"))
+	executor, err := bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Backend:  backend,
+		Logger:   loggo.GetLogger("bundlechanges"),
+		Parallel: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = executor.Execute(changes)
+	c.Assert(err, gc.ErrorMatches, `cannot apply change "addCharm-[0-9]+": boom`)
+	// The machine of the first wave is not added once the charms failed.
+	calls := backend.Calls()
+	c.Assert(calls, gc.HasLen, 2)
+	c.Check(calls[0].Method, gc.Equals, "AddCharm")
+	c.Check(calls[1].Method, gc.Equals, "AddCharm")
+}
+
+func (s *executorSuite) TestNewExecutorValidatesConfig(c *gc.C) {
+	_, err := bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, gc.ErrorMatches, "nil Backend not valid")
+	_, err = bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Backend: bundlechanges.NewFakeBackend(nil),
+	})
+	c.Assert(err, gc.ErrorMatches, "nil Logger not valid")
+}
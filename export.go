@@ -0,0 +1,215 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"sort"
+
+	"github.com/juju/charm/v9"
+	"github.com/juju/errors"
+	"github.com/juju/names/v4"
+)
+
+// ExportBundle returns the bundle describing the given model, so that
+// diffing the bundle against the model finds no differences.
+//
+// The bundle machines keep the ids of the model machines, unless the
+// machine map of the model maps bundle machines to them. Only the machines
+// hosting units are exported, as bundles can't declare unused machines, and
+// units on containers are placed in new containers of their host. A model
+// without machines whose applications have a scale is exported as a
+// Kubernetes bundle.
+func ExportBundle(model *Model) (*charm.BundleData, error) {
+	if model == nil {
+		return nil, errors.NotValidf("nil model")
+	}
+	data := &charm.BundleData{
+		Applications: make(map[string]*charm.ApplicationSpec),
+	}
+	if model.isKubernetes() {
+		data.Type = kubernetes
+	}
+	bundleMachines, err := model.bundleMachineIDs()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for name, app := range model.Applications {
+		application, machines := exportApplication(app, data.Type, bundleMachines)
+		data.Applications[name] = application
+		for _, modelID := range machines {
+			if data.Machines == nil {
+				data.Machines = make(map[string]*charm.MachineSpec)
+			}
+			data.Machines[bundleMachines[modelID]] = exportMachine(model.Machines[modelID])
+		}
+	}
+	for name, remote := range model.RemoteApplications {
+		if data.Saas == nil {
+			data.Saas = make(map[string]*charm.SaasSpec)
+		}
+		data.Saas[name] = &charm.SaasSpec{URL: remote.OfferURL}
+	}
+	if data.Relations, err = model.exportRelations(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return data, nil
+}
+
+// isKubernetes returns whether the model looks like a Kubernetes model, that
+// is it has no machines but applications with a scale.
+func (m *Model) isKubernetes() bool {
+	if len(m.Machines) != 0 {
+		return false
+	}
+	for _, app := range m.Applications {
+		if app.Scale != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleMachineIDs returns the bundle machine ids of the top level machines
+// of the model, keyed by model machine id.
+func (m *Model) bundleMachineIDs() (map[string]string, error) {
+	result := make(map[string]string)
+	for bundleID, modelID := range m.MachineMap {
+		if _, found := m.Machines[modelID]; found && !names.IsContainerMachine(modelID) {
+			result[modelID] = bundleID
+		}
+	}
+	for modelID := range m.Machines {
+		if names.IsContainerMachine(modelID) {
+			continue
+		}
+		if _, found := result[modelID]; found {
+			continue
+		}
+		if mapped, found := m.MachineMap[modelID]; found {
+			return nil, errors.Errorf("cannot export machine %q: bundle machine %q is mapped to machine %q", modelID, modelID, mapped)
+		}
+		result[modelID] = modelID
+	}
+	return result, nil
+}
+
+// exportApplication returns the bundle application describing the given
+// application, and the ids of the model machines hosting its units.
+func exportApplication(app *Application, bundleType string, bundleMachines map[string]string) (*charm.ApplicationSpec, []string) {
+	application := &charm.ApplicationSpec{
+		Charm:            app.Charm,
+		Channel:          app.Channel,
+		Series:           app.Series,
+		Options:          app.Options,
+		Annotations:      app.Annotations,
+		Constraints:      app.Constraints,
+		Storage:          app.Storage,
+		Devices:          app.Devices,
+		EndpointBindings: app.EndpointBindings,
+		RequiresTrust:    app.Trust != nil && *app.Trust,
+	}
+	// Bundles with per-endpoint expose settings must not set the exposed
+	// flag as well.
+	if len(app.ExposedEndpoints) != 0 {
+		application.ExposedEndpoints = make(map[string]charm.ExposedEndpointSpec)
+		for endpoint, exposed := range app.ExposedEndpoints {
+			application.ExposedEndpoints[endpoint] = charm.ExposedEndpointSpec{
+				ExposeToSpaces: exposed.ExposeToSpaces,
+				ExposeToCIDRs:  exposed.ExposeToCIDRs,
+			}
+		}
+	} else {
+		application.Expose = app.Exposed
+	}
+	if len(app.Resources)+len(app.LocalResources) != 0 {
+		application.Resources = make(map[string]interface{})
+		for name, path := range app.LocalResources {
+			application.Resources[name] = path
+		}
+		for name, revision := range app.Resources {
+			application.Resources[name] = revision
+		}
+	}
+	for _, name := range app.Offers {
+		if application.Offers == nil {
+			application.Offers = make(map[string]*charm.OfferSpec)
+		}
+		application.Offers[name] = &charm.OfferSpec{
+			Endpoints: app.OfferEndpoints[name],
+			ACL:       app.OfferACLs[name],
+		}
+	}
+
+	if bundleType == kubernetes {
+		application.NumUnits = app.Scale
+		if app.Placement != "" {
+			application.To = []string{app.Placement}
+		}
+		return application, nil
+	}
+	if len(app.SubordinateTo) != 0 {
+		// Subordinate units go where their principals are.
+		return application, nil
+	}
+	units := append([]Unit(nil), app.Units...)
+	sort.SliceStable(units, func(i, j int) bool {
+		return unitNumber(units[i].Name) < unitNumber(units[j].Name)
+	})
+	application.NumUnits = len(units)
+	var machines []string
+	for _, unit := range units {
+		if unit.Machine == "" {
+			continue
+		}
+		host := topLevelMachine(unit.Machine)
+		bundleID, found := bundleMachines[host]
+		if !found {
+			continue
+		}
+		directive := bundleID
+		if names.IsContainerMachine(unit.Machine) {
+			directive = names.NewMachineTag(unit.Machine).ContainerType() + ":" + bundleID
+		}
+		application.To = append(application.To, directive)
+		machines = append(machines, host)
+	}
+	return application, machines
+}
+
+func exportMachine(machine *Machine) *charm.MachineSpec {
+	if machine == nil || machine.Constraints == "" && machine.Series == "" && len(machine.Annotations) == 0 {
+		return nil
+	}
+	return &charm.MachineSpec{
+		Constraints: machine.Constraints,
+		Series:      machine.Series,
+		Annotations: machine.Annotations,
+	}
+}
+
+// exportRelations returns the relations of the model as bundle relations,
+// in canonical order. Peer relations are left out, and other relations
+// between the endpoints of an application can't be exported, as bundles
+// can't declare them.
+func (m *Model) exportRelations() ([][]string, error) {
+	seen := make(map[Relation]bool)
+	var relations []Relation
+	for _, original := range m.Relations {
+		relation := canonicalRelation(original)
+		if isPeerRelation(relation) || seen[relation] {
+			continue
+		}
+		if relation.App1 == relation.App2 {
+			return nil, errors.Errorf("cannot export relation %s:%s - %s:%s: relates an application to itself",
+				relation.App1, relation.Endpoint1, relation.App2, relation.Endpoint2)
+		}
+		seen[relation] = true
+		relations = append(relations, relation)
+	}
+	if len(relations) == 0 {
+		return nil, nil
+	}
+	sort.Slice(relations, relationLess(relations))
+	return toRelationSlices(relations), nil
+}
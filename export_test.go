@@ -0,0 +1,207 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges_test
+
+import (
+	"strings"
+
+	"github.com/juju/charm/v9"
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/bundlechanges/v5"
+)
+
+type exportSuite struct{}
+
+var _ = gc.Suite(&exportSuite{})
+
+func (s *exportSuite) checkEmptyDiff(c *gc.C, data *charm.BundleData, model *bundlechanges.Model) {
+	diff, err := bundlechanges.BuildDiff(bundlechanges.DiffConfig{
+		Bundle:             data,
+		Model:              model,
+		IncludeAnnotations: true,
+		Logger:             loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(diff.Empty(), jc.IsTrue, gc.Commentf("diff: %#v", diff))
+}
+
+func (s *exportSuite) TestExportBundle(c *gc.C) {
+	trusted := true
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Name:        "django",
+				Charm:       "cs:django-4",
+				Series:      "bionic",
+				Options:     map[string]interface{}{"debug": true},
+				Annotations: map[string]string{"gui-x": "10"},
+				Constraints: "mem=2G",
+				Exposed:     true,
+				Trust:       &trusted,
+				Resources:   map[string]int{"data": 3},
+				Offers:      []string{"web"},
+				OfferEndpoints: map[string][]string{
+					"web": {"website"},
+				},
+				OfferACLs: map[string]map[string]string{
+					"web": {"admin": "admin"},
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "django/10", Machine: "2/lxd/0"},
+					{Name: "django/2", Machine: "3"},
+				},
+			},
+			"mysql": {
+				Name:   "mysql",
+				Charm:  "cs:mysql-58",
+				Series: "bionic",
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+					"db": {ExposeToSpaces: []string{"internal"}},
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "mysql/0", Machine: "2"},
+				},
+			},
+			"ntp": {
+				Name:          "ntp",
+				Charm:         "cs:ntp-3",
+				Series:        "bionic",
+				SubordinateTo: []string{"django"},
+				Units: []bundlechanges.Unit{
+					{Name: "ntp/0", Machine: "3"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"2":       {ID: "2", Series: "bionic", Constraints: "cores=4"},
+			"2/lxd/0": {ID: "2/lxd/0", Series: "bionic", ContainerType: "lxd", ParentID: "2"},
+			"3":       {ID: "3", Series: "bionic"},
+		},
+		Relations: []bundlechanges.Relation{
+			{App1: "mysql", Endpoint1: "db", App2: "django", Endpoint2: "db"},
+			{App1: "ntp", Endpoint1: "juju-info", App2: "django", Endpoint2: "juju-info"},
+			{App1: "django", Endpoint1: "db", App2: "mysql", Endpoint2: "db"},
+			{App1: "mysql", Endpoint1: "cluster", App2: "mysql", Endpoint2: "cluster"},
+			{App1: "django", Endpoint1: "logging", App2: "logs", Endpoint2: "logging"},
+		},
+		RemoteApplications: map[string]*bundlechanges.RemoteApplication{
+			"logs": {Name: "logs", OfferURL: "admin/other.logs"},
+		},
+		MachineMap: map[string]string{"0": "2"},
+	}
+	data, err := bundlechanges.ExportBundle(model)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Verify(nil, nil, nil), jc.ErrorIsNil)
+
+	c.Check(data.Machines, jc.DeepEquals, map[string]*charm.MachineSpec{
+		"0": {Series: "bionic", Constraints: "cores=4"},
+		"3": {Series: "bionic"},
+	})
+	django := data.Applications["django"]
+	c.Check(django.NumUnits, gc.Equals, 2)
+	c.Check(django.To, jc.DeepEquals, []string{"3", "lxd:0"})
+	c.Check(django.Expose, jc.IsTrue)
+	c.Check(django.RequiresTrust, jc.IsTrue)
+	c.Check(django.Resources, jc.DeepEquals, map[string]interface{}{"data": 3})
+	c.Check(django.Offers, jc.DeepEquals, map[string]*charm.OfferSpec{
+		"web": {Endpoints: []string{"website"}, ACL: map[string]string{"admin": "admin"}},
+	})
+	mysql := data.Applications["mysql"]
+	c.Check(mysql.Expose, jc.IsFalse)
+	c.Check(mysql.ExposedEndpoints, jc.DeepEquals, map[string]charm.ExposedEndpointSpec{
+		"db": {ExposeToSpaces: []string{"internal"}},
+	})
+	ntp := data.Applications["ntp"]
+	c.Check(ntp.NumUnits, gc.Equals, 0)
+	c.Check(ntp.To, gc.HasLen, 0)
+	c.Check(data.Saas, jc.DeepEquals, map[string]*charm.SaasSpec{
+		"logs": {URL: "admin/other.logs"},
+	})
+	c.Check(data.Relations, jc.DeepEquals, [][]string{
+		{"django:db", "mysql:db"},
+		{"django:juju-info", "ntp:juju-info"},
+		{"django:logging", "logs:logging"},
+	})
+
+	s.checkEmptyDiff(c, data, model)
+}
+
+func (s *exportSuite) TestExportKubernetesBundle(c *gc.C) {
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"mariadb": {
+				Name:      "mariadb",
+				Charm:     "cs:~juju/mariadb-k8s-3",
+				Series:    "kubernetes",
+				Scale:     2,
+				Placement: "foo=bar",
+			},
+		},
+	}
+	data, err := bundlechanges.ExportBundle(model)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(data.Type, gc.Equals, "kubernetes")
+	c.Check(data.Machines, gc.HasLen, 0)
+	c.Check(data.Applications["mariadb"].NumUnits, gc.Equals, 2)
+	c.Check(data.Applications["mariadb"].To, jc.DeepEquals, []string{"foo=bar"})
+
+	s.checkEmptyDiff(c, data, model)
+}
+
+func (s *exportSuite) TestExportBundleFromStatus(c *gc.C) {
+	model, err := bundlechanges.ModelFromStatus(strings.NewReader(yamlStatus))
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := bundlechanges.ExportBundle(model)
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkEmptyDiff(c, data, model)
+}
+
+func (s *exportSuite) TestExportConflictingMachineMap(c *gc.C) {
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Name:  "django",
+				Charm: "cs:django-4",
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0"},
+			"1": {ID: "1"},
+		},
+		MachineMap: map[string]string{"0": "1"},
+	}
+	_, err := bundlechanges.ExportBundle(model)
+	c.Assert(err, gc.ErrorMatches, `cannot export machine "0": bundle machine "0" is mapped to machine "1"`)
+}
+
+func (s *exportSuite) TestExportSelfRelation(c *gc.C) {
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"mysql": {Name: "mysql", Charm: "cs:mysql-58"},
+		},
+		Relations: []bundlechanges.Relation{{
+			App1: "mysql", Endpoint1: "cluster",
+			App2: "mysql", Endpoint2: "cluster",
+		}},
+	}
+	// Peer relations are left out, as BuildDiff ignores them.
+	data, err := bundlechanges.ExportBundle(model)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Relations, gc.HasLen, 0)
+	s.checkEmptyDiff(c, data, model)
+
+	// Other relations within an application can't be declared in bundles.
+	model.Relations = append(model.Relations, bundlechanges.Relation{
+		App1: "mysql", Endpoint1: "master",
+		App2: "mysql", Endpoint2: "slave",
+	})
+	_, err = bundlechanges.ExportBundle(model)
+	c.Assert(err, gc.ErrorMatches, `cannot export relation mysql:master - mysql:slave: relates an application to itself`)
+}
@@ -0,0 +1,632 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// FakeCall records a call to a FakeBackend.
+type FakeCall struct {
+	// Method is the name of the backend method, such as "AddUnit".
+	Method string
+	// Params holds the params the method was called with.
+	Params interface{}
+}
+
+// FakeBackend is a Backend that applies the changes to an in-memory
+// model, for testing executors and the plans they apply.
+type FakeBackend struct {
+	mu    sync.Mutex
+	model *Model
+	calls []FakeCall
+	errs  map[string]error
+}
+
+var _ Backend = (*FakeBackend)(nil)
+
+// NewFakeBackend returns a backend that applies the changes to the given
+// model. A nil model is the same as an empty one.
+func NewFakeBackend(model *Model) *FakeBackend {
+	if model == nil {
+		model = &Model{}
+	}
+	if model.Applications == nil {
+		model.Applications = make(map[string]*Application)
+	}
+	if model.Machines == nil {
+		model.Machines = make(map[string]*Machine)
+	}
+	if model.RemoteApplications == nil {
+		model.RemoteApplications = make(map[string]*RemoteApplication)
+	}
+	model.initializeSequence()
+	return &FakeBackend{
+		model: model,
+		errs:  make(map[string]error),
+	}
+}
+
+// Model returns the model the changes are applied to.
+func (b *FakeBackend) Model() *Model {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.model
+}
+
+// Calls returns the calls made to the backend, in order.
+func (b *FakeBackend) Calls() []FakeCall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]FakeCall(nil), b.calls...)
+}
+
+// SetError makes the calls to the given method, such as "AddUnit", fail
+// with the error. A nil error makes them succeed again.
+func (b *FakeBackend) SetError(method string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errs[method] = err
+}
+
+// call records the call and returns the error set for the method. It must
+// be called with the lock held.
+func (b *FakeBackend) call(method string, params interface{}) error {
+	b.calls = append(b.calls, FakeCall{Method: method, Params: params})
+	return b.errs[method]
+}
+
+func (b *FakeBackend) application(name string) (*Application, error) {
+	app := b.model.Applications[name]
+	if app == nil {
+		return nil, errors.NotFoundf("application %q", name)
+	}
+	return app, nil
+}
+
+// AddCharm implements Backend.
+func (b *FakeBackend) AddCharm(params AddCharmParams) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("AddCharm", params); err != nil {
+		return "", err
+	}
+	return params.Charm, nil
+}
+
+// UpgradeCharm implements Backend.
+func (b *FakeBackend) UpgradeCharm(params UpgradeCharmParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("UpgradeCharm", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	app.Charm = params.Charm
+	if params.Channel != "" {
+		app.Channel = params.Channel
+	}
+	return nil
+}
+
+// AddApplication implements Backend.
+func (b *FakeBackend) AddApplication(params AddApplicationParams) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("AddApplication", params); err != nil {
+		return "", err
+	}
+	if b.model.Applications[params.Application] != nil {
+		return "", errors.AlreadyExistsf("application %q", params.Application)
+	}
+	b.model.Applications[params.Application] = &Application{
+		Name:             params.Application,
+		Charm:            params.Charm,
+		Scale:            params.NumUnits,
+		Options:          params.Options,
+		Constraints:      params.Constraints,
+		Trust:            &params.Trust,
+		Series:           params.Series,
+		Channel:          params.Channel,
+		Storage:          params.Storage,
+		Devices:          params.Devices,
+		EndpointBindings: params.EndpointBindings,
+		Resources:        params.Resources,
+		LocalResources:   params.LocalResources,
+	}
+	return params.Application, nil
+}
+
+// AddMachine implements Backend.
+func (b *FakeBackend) AddMachine(params AddMachineParams) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("AddMachine", params); err != nil {
+		return "", err
+	}
+	if params.ContainerType == "" {
+		return b.addMachine(params.Series, params.Constraints), nil
+	}
+	parent := params.ParentId
+	if parent == "" {
+		parent = b.addMachine(params.Series, "")
+	} else if b.model.Machines[parent] == nil {
+		return "", errors.NotFoundf("machine %q", parent)
+	}
+	return b.addContainer(parent, params.ContainerType, params.Series, params.Constraints), nil
+}
+
+func (b *FakeBackend) addMachine(series, constraints string) string {
+	id := b.model.nextMachine()
+	b.model.Machines[id] = &Machine{
+		ID:          id,
+		Series:      series,
+		Constraints: constraints,
+	}
+	return id
+}
+
+func (b *FakeBackend) addContainer(parent, containerType, series, constraints string) string {
+	id := b.model.nextContainer(parent, containerType)
+	b.model.Machines[id] = &Machine{
+		ID:            id,
+		Series:        series,
+		Constraints:   constraints,
+		ContainerType: containerType,
+		ParentID:      parent,
+	}
+	return id
+}
+
+// AddUnit implements Backend. Units without placement go to new machines.
+func (b *FakeBackend) AddUnit(params AddUnitParams) (string, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("AddUnit", params); err != nil {
+		return "", "", err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return "", "", err
+	}
+	var machine string
+	switch parts := strings.SplitN(params.To, ":", 2); {
+	case params.To == "":
+		machine = b.addMachine(app.Series, app.Constraints)
+	case len(parts) == 2:
+		if b.model.Machines[parts[1]] == nil {
+			return "", "", errors.NotFoundf("machine %q", parts[1])
+		}
+		machine = b.addContainer(parts[1], parts[0], app.Series, app.Constraints)
+	default:
+		if b.model.Machines[params.To] == nil {
+			return "", "", errors.NotFoundf("machine %q", params.To)
+		}
+		machine = params.To
+	}
+	unit := b.model.nextUnit(app.Name)
+	app.Units = append(app.Units, Unit{Name: unit, Machine: machine})
+	return unit, machine, nil
+}
+
+// AddRelation implements Backend.
+func (b *FakeBackend) AddRelation(params AddRelationParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("AddRelation", params); err != nil {
+		return err
+	}
+	ep1, ep2 := parseEndpoint(params.Endpoint1), parseEndpoint(params.Endpoint2)
+	for _, ep := range []*endpoint{ep1, ep2} {
+		if b.model.Applications[ep.application] == nil && b.model.RemoteApplications[ep.application] == nil {
+			return errors.NotFoundf("application %q", ep.application)
+		}
+	}
+	if b.model.HasRelation(ep1.application, ep1.relation, ep2.application, ep2.relation) {
+		return errors.AlreadyExistsf("relation %q", params.Endpoint1+" "+params.Endpoint2)
+	}
+	b.model.Relations = append(b.model.Relations, Relation{
+		App1:      ep1.application,
+		Endpoint1: ep1.relation,
+		App2:      ep2.application,
+		Endpoint2: ep2.relation,
+	})
+	return nil
+}
+
+// Expose implements Backend.
+func (b *FakeBackend) Expose(params ExposeParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("Expose", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	app.Exposed = true
+	for name, endpoint := range params.ExposedEndpoints {
+		if app.ExposedEndpoints == nil {
+			app.ExposedEndpoints = make(map[string]ExposedEndpoint)
+		}
+		app.ExposedEndpoints[name] = ExposedEndpoint{
+			ExposeToSpaces: endpoint.ExposeToSpaces,
+			ExposeToCIDRs:  endpoint.ExposeToCIDRs,
+		}
+	}
+	return nil
+}
+
+// Unexpose implements Backend.
+func (b *FakeBackend) Unexpose(params UnexposeParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("Unexpose", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	for _, name := range params.ExposedEndpoints {
+		delete(app.ExposedEndpoints, name)
+	}
+	if len(params.ExposedEndpoints) == 0 || len(app.ExposedEndpoints) == 0 {
+		app.Exposed = false
+		app.ExposedEndpoints = nil
+	}
+	return nil
+}
+
+// Scale implements Backend.
+func (b *FakeBackend) Scale(params ScaleParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("Scale", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	app.Scale = params.Scale
+	return nil
+}
+
+// SetAnnotations implements Backend.
+func (b *FakeBackend) SetAnnotations(params SetAnnotationsParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("SetAnnotations", params); err != nil {
+		return err
+	}
+	var annotations *map[string]string
+	switch params.EntityType {
+	case ApplicationType:
+		app, err := b.application(params.Id)
+		if err != nil {
+			return err
+		}
+		annotations = &app.Annotations
+	case MachineType:
+		machine := b.model.Machines[params.Id]
+		if machine == nil {
+			return errors.NotFoundf("machine %q", params.Id)
+		}
+		annotations = &machine.Annotations
+	default:
+		return errors.NotSupportedf("entity type %q", params.EntityType)
+	}
+	if *annotations == nil {
+		*annotations = make(map[string]string)
+	}
+	for key, value := range params.Annotations {
+		(*annotations)[key] = value
+	}
+	return nil
+}
+
+// SetOptions implements Backend.
+func (b *FakeBackend) SetOptions(params SetOptionsParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("SetOptions", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	if app.Options == nil {
+		app.Options = make(map[string]interface{})
+	}
+	for key, value := range params.Options {
+		if value == nil {
+			delete(app.Options, key)
+			continue
+		}
+		app.Options[key] = value
+	}
+	return nil
+}
+
+// SetConstraints implements Backend.
+func (b *FakeBackend) SetConstraints(params SetConstraintsParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("SetConstraints", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	app.Constraints = params.Constraints
+	return nil
+}
+
+// AddStorage implements Backend.
+func (b *FakeBackend) AddStorage(params AddStorageParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("AddStorage", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	if app.Storage == nil {
+		app.Storage = make(map[string]string)
+	}
+	app.Storage[params.StorageName] = params.Storage
+	return nil
+}
+
+// Bind implements Backend.
+func (b *FakeBackend) Bind(params BindParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("Bind", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	if app.EndpointBindings == nil {
+		app.EndpointBindings = make(map[string]string)
+	}
+	for endpoint, space := range params.EndpointBindings {
+		app.EndpointBindings[endpoint] = space
+	}
+	return nil
+}
+
+// SetTrust implements Backend.
+func (b *FakeBackend) SetTrust(params SetTrustParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("SetTrust", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	app.Trust = &params.Trust
+	return nil
+}
+
+// CreateOffer implements Backend.
+func (b *FakeBackend) CreateOffer(params CreateOfferParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("CreateOffer", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	offered := false
+	for _, offer := range app.Offers {
+		offered = offered || offer == params.OfferName
+	}
+	if offered && !params.Update {
+		return errors.AlreadyExistsf("offer %q", params.OfferName)
+	}
+	if !offered {
+		app.Offers = append(app.Offers, params.OfferName)
+	}
+	if app.OfferEndpoints == nil {
+		app.OfferEndpoints = make(map[string][]string)
+	}
+	app.OfferEndpoints[params.OfferName] = params.Endpoints
+	return nil
+}
+
+// ConsumeOffer implements Backend. The remote application is named after
+// the offer unless the params name it.
+func (b *FakeBackend) ConsumeOffer(params ConsumeOfferParams) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("ConsumeOffer", params); err != nil {
+		return "", err
+	}
+	name := params.ApplicationName
+	if name == "" {
+		name = params.URL[strings.LastIndexAny(params.URL, "./:")+1:]
+	}
+	if b.model.RemoteApplications[name] != nil {
+		return "", errors.AlreadyExistsf("remote application %q", name)
+	}
+	b.model.RemoteApplications[name] = &RemoteApplication{
+		Name:     name,
+		OfferURL: params.URL,
+	}
+	return name, nil
+}
+
+// offerApplication returns the application offered with the given name.
+func (b *FakeBackend) offerApplication(offer string) (*Application, error) {
+	for _, app := range b.model.Applications {
+		for _, name := range app.Offers {
+			if name == offer {
+				return app, nil
+			}
+		}
+	}
+	return nil, errors.NotFoundf("offer %q", offer)
+}
+
+// GrantOfferAccess implements Backend.
+func (b *FakeBackend) GrantOfferAccess(params GrantOfferAccessParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("GrantOfferAccess", params); err != nil {
+		return err
+	}
+	app, err := b.offerApplication(params.Offer)
+	if err != nil {
+		return err
+	}
+	if app.OfferACLs == nil {
+		app.OfferACLs = make(map[string]map[string]string)
+	}
+	if app.OfferACLs[params.Offer] == nil {
+		app.OfferACLs[params.Offer] = make(map[string]string)
+	}
+	app.OfferACLs[params.Offer][params.User] = params.Access
+	return nil
+}
+
+// RevokeOfferAccess implements Backend.
+func (b *FakeBackend) RevokeOfferAccess(params RevokeOfferAccessParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("RevokeOfferAccess", params); err != nil {
+		return err
+	}
+	app, err := b.offerApplication(params.Offer)
+	if err != nil {
+		return err
+	}
+	delete(app.OfferACLs[params.Offer], params.User)
+	return nil
+}
+
+// RemoveOffer implements Backend.
+func (b *FakeBackend) RemoveOffer(params RemoveOfferParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("RemoveOffer", params); err != nil {
+		return err
+	}
+	app, err := b.application(params.Application)
+	if err != nil {
+		return err
+	}
+	var offers []string
+	for _, offer := range app.Offers {
+		if offer != params.OfferName {
+			offers = append(offers, offer)
+		}
+	}
+	if len(offers) == len(app.Offers) {
+		return errors.NotFoundf("offer %q", params.OfferName)
+	}
+	app.Offers = offers
+	delete(app.OfferEndpoints, params.OfferName)
+	delete(app.OfferACLs, params.OfferName)
+	return nil
+}
+
+// RemoveApplication implements Backend. The relations of the application
+// are removed with it.
+func (b *FakeBackend) RemoveApplication(params RemoveApplicationParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("RemoveApplication", params); err != nil {
+		return err
+	}
+	if _, err := b.application(params.Application); err != nil {
+		return err
+	}
+	delete(b.model.Applications, params.Application)
+	var relations []Relation
+	for _, relation := range b.model.Relations {
+		if relation.App1 != params.Application && relation.App2 != params.Application {
+			relations = append(relations, relation)
+		}
+	}
+	b.model.Relations = relations
+	return nil
+}
+
+// RemoveUnit implements Backend.
+func (b *FakeBackend) RemoveUnit(params RemoveUnitParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("RemoveUnit", params); err != nil {
+		return err
+	}
+	app, err := b.application(strings.Split(params.Unit, "/")[0])
+	if err != nil {
+		return err
+	}
+	for i, unit := range app.Units {
+		if unit.Name == params.Unit {
+			app.Units = append(app.Units[:i:i], app.Units[i+1:]...)
+			return nil
+		}
+	}
+	return errors.NotFoundf("unit %q", params.Unit)
+}
+
+// RemoveMachine implements Backend.
+func (b *FakeBackend) RemoveMachine(params RemoveMachineParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("RemoveMachine", params); err != nil {
+		return err
+	}
+	if b.model.Machines[params.Machine] == nil {
+		return errors.NotFoundf("machine %q", params.Machine)
+	}
+	for _, app := range b.model.Applications {
+		for _, unit := range app.Units {
+			if unit.Machine == params.Machine {
+				return errors.Errorf("machine %q hosts unit %q", params.Machine, unit.Name)
+			}
+		}
+	}
+	delete(b.model.Machines, params.Machine)
+	return nil
+}
+
+// RemoveRelation implements Backend.
+func (b *FakeBackend) RemoveRelation(params RemoveRelationParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.call("RemoveRelation", params); err != nil {
+		return err
+	}
+	ep1, ep2 := parseEndpoint(params.Endpoint1), parseEndpoint(params.Endpoint2)
+	for i, relation := range b.model.Relations {
+		if (relation == Relation{App1: ep1.application, Endpoint1: ep1.relation, App2: ep2.application, Endpoint2: ep2.relation}) ||
+			(relation == Relation{App1: ep2.application, Endpoint1: ep2.relation, App2: ep1.application, Endpoint2: ep1.relation}) {
+			b.model.Relations = append(b.model.Relations[:i:i], b.model.Relations[i+1:]...)
+			return nil
+		}
+	}
+	return errors.NotFoundf("relation %q", params.Endpoint1+" "+params.Endpoint2)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/juju/charmrepo/v7"
 	"github.com/juju/collections/set"
 	"github.com/juju/errors"
+	"github.com/juju/names/v4"
 	"github.com/juju/naturalsort"
 )
 
@@ -24,6 +25,15 @@ type resolver struct {
 	charmResolver    CharmResolver
 	changes          *changeset
 	force            bool
+	unexpose         bool
+
+	pruneApplications bool
+	pruneUnits        bool
+	pruneRelations    bool
+	pruneOffers       bool
+	pruneMachines     bool
+
+	unitRemovalPolicy UnitRemovalPolicy
 }
 
 // handleApplications populates the change set with "addCharm"/"addApplication" records.
@@ -127,6 +137,7 @@ func (r *resolver) handleApplications() (map[string]string, error) {
 				LocalResources:   localResources,
 				charmURL:         application.Charm,
 				Channel:          application.Channel,
+				Trust:            application.RequiresTrust,
 			}, requires...)
 			add(change)
 			id = change.Id()
@@ -142,15 +153,25 @@ func (r *resolver) handleApplications() (map[string]string, error) {
 			}
 		} else {
 			// Look for changes.
-			if ok, err := r.allowCharmUpgrade(existingApp, application, arch); err != nil {
+			upgrade, err := r.allowCharmUpgrade(existingApp, application, arch)
+			if err != nil {
 				return nil, errors.Trace(err)
-			} else if ok {
+			}
+			// Without a charm upgrade, only the resources that differ from
+			// the deployed ones need to be attached.
+			changedResources, changedLocalResources := existingApp.changedResources(resources, localResources)
+			// The changes to the application are applied after its charm
+			// is upgraded.
+			var appRequires []string
+			if upgrade || changedResources != nil || changedLocalResources != nil {
+				var requires []string
 				charmOrChange := application.Charm
 				if charmChange := charms[key]; charmChange != "" {
+					requires = append(requires, charmChange)
 					charmOrChange = placeholder(charmChange)
 				}
 
-				change = newUpgradeCharm(UpgradeCharmParams{
+				params := UpgradeCharmParams{
 					Charm:          charmOrChange,
 					Application:    name,
 					Series:         series,
@@ -158,15 +179,22 @@ func (r *resolver) handleApplications() (map[string]string, error) {
 					Resources:      resources,
 					LocalResources: localResources,
 					charmURL:       application.Charm,
-				})
+				}
+				if !upgrade {
+					params.Resources = changedResources
+					params.LocalResources = changedLocalResources
+					params.resourcesOnly = true
+				}
+				change = newUpgradeCharm(params, requires...)
 				add(change)
+				appRequires = append(appRequires, change.Id())
 			}
 
 			if changes := existingApp.changedOptions(application.Options); len(changes) > 0 {
 				change = newSetOptionsChange(SetOptionsParams{
 					Application: name,
 					Options:     changes,
-				})
+				}, appRequires...)
 				add(change)
 			}
 
@@ -174,24 +202,77 @@ func (r *resolver) handleApplications() (map[string]string, error) {
 				change = newSetConstraintsChange(SetConstraintsParams{
 					Application: name,
 					Constraints: application.Constraints,
-				})
+				}, appRequires...)
 				add(change)
 			}
 
-			// We never do the negative. We will expose if necessary, but
-			// never unexpose.
+			// Devices are only requested when an application is deployed.
+			if changedDevices := existingApp.changedDevices(application.Devices); len(changedDevices) > 0 {
+				return nil, &DeviceChangeError{
+					Application: name,
+					Devices:     changedDevices,
+				}
+			}
+
+			// Storage can only be added to a deployed application.
+			addedStorage, changedStorage := existingApp.changedStorage(application.Storage)
+			if len(changedStorage) > 0 {
+				return nil, &StorageChangeError{
+					Application: name,
+					Storage:     changedStorage,
+				}
+			}
+			storageNames := make([]string, 0, len(addedStorage))
+			for storageName := range addedStorage {
+				storageNames = append(storageNames, storageName)
+			}
+			sort.Strings(storageNames)
+			for _, storageName := range storageNames {
+				// The stores may be declared by the upgraded charm.
+				add(newAddStorageChange(AddStorageParams{
+					Application: name,
+					StorageName: storageName,
+					Storage:     addedStorage[storageName],
+				}, appRequires...))
+			}
+
+			if existingApp.changedTrust(application.RequiresTrust) {
+				add(newSetTrustChange(SetTrustParams{
+					Application: name,
+					Trust:       application.RequiresTrust,
+				}, appRequires...))
+			}
+
+			if bindings := existingApp.changedBindings(application.EndpointBindings); len(bindings) > 0 {
+				add(newBindChange(BindParams{
+					Application:      name,
+					EndpointBindings: bindings,
+				}, appRequires...))
+			}
+
+			// We will expose if necessary, but only unexpose when asked to.
+			unexposeRequires := append([]string(nil), appRequires...)
 			if application.Expose || len(application.ExposedEndpoints) != 0 {
 				// We emit a change if the app is not exposed
 				// OR the app is already exposed but the
 				// current expose endpoint params do not match
 				// the incoming params.
 				if !existingApp.Exposed || (existingApp.Exposed && !equalExposeParams(existingApp, application)) {
-					add(newExposeChange(ExposeParams{
+					change = newExposeChange(ExposeParams{
 						Application:      name,
 						ExposedEndpoints: mapExposedEndpointSpec(application.ExposedEndpoints),
 						appName:          name,
 						alreadyExposed:   existingApp.Exposed,
-					}))
+					}, appRequires...)
+					add(change)
+					// The endpoints are unexposed once the new ones are
+					// exposed.
+					unexposeRequires = append(unexposeRequires, change.Id())
+				}
+			}
+			if r.unexpose {
+				if params := unexposeParams(name, existingApp, application); params != nil {
+					add(newUnexposeChange(*params, unexposeRequires...))
 				}
 			}
 
@@ -200,7 +281,7 @@ func (r *resolver) handleApplications() (map[string]string, error) {
 					Application: name,
 					appName:     name,
 					Scale:       application.NumUnits,
-				}))
+				}, appRequires...))
 			}
 		}
 
@@ -305,6 +386,37 @@ func mapExposedEndpointSpec(specs map[string]charm.ExposedEndpointSpec) map[stri
 	return out
 }
 
+// unexposeParams returns the parameters for unexposing whatever the existing
+// application exposes but the bundle application does not, or nil if there
+// is nothing to unexpose. An application exposed in the bundle without any
+// endpoint details exposes all its endpoints, as it does for BuildDiff.
+func unexposeParams(name string, existingApp *Application, application *charm.ApplicationSpec) *UnexposeParams {
+	if !existingApp.Exposed && len(existingApp.ExposedEndpoints) == 0 {
+		return nil
+	}
+	if !application.Expose && len(application.ExposedEndpoints) == 0 {
+		return &UnexposeParams{Application: name}
+	}
+
+	var endpoints []string
+	for epName := range existingApp.ExposedEndpoints {
+		if len(application.ExposedEndpoints) == 0 && epName == allEndpoints {
+			continue
+		}
+		if _, found := application.ExposedEndpoints[epName]; !found {
+			endpoints = append(endpoints, epName)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+	sort.Strings(endpoints)
+	return &UnexposeParams{
+		Application:      name,
+		ExposedEndpoints: endpoints,
+	}
+}
+
 func equalExposeParams(cur *Application, incoming *charm.ApplicationSpec) bool {
 	if len(cur.ExposedEndpoints) != len(incoming.ExposedEndpoints) {
 		return false
@@ -431,11 +543,15 @@ func (r *resolver) handleRelations(addedApplications map[string]string) {
 
 		getEndpointNames := func(ep *endpoint) (string, string) {
 			// If the application exists, then we don't require it, and the param
-			// is the endpoint string not a placeholder.
+			// is the endpoint string not a placeholder. The same goes for the
+			// offers that the model already consumes.
 			nice := ep.String()
 			if app := existing.GetApplication(ep.application); app != nil {
 				return nice, nice
 			}
+			if remoteApp := existing.RemoteApplications[ep.application]; remoteApp != nil {
+				return nice, nice
+			}
 			pendingApp := addedApplications[ep.application]
 			ep.application = pendingApp
 			requires = append(requires, pendingApp)
@@ -462,7 +578,25 @@ func (r *resolver) handleOffers(addedApplications map[string]string, deployedBun
 	// the bundle should have been verified before calling handling of types
 	// as saas applications will stamp on existing applications with the same
 	// name.
-	for name, saasSpec := range r.bundle.Saas {
+	saasNames := make([]string, 0, len(r.bundle.Saas))
+	for name := range r.bundle.Saas {
+		saasNames = append(saasNames, name)
+	}
+	sort.Strings(saasNames)
+	for _, name := range saasNames {
+		saasSpec := r.bundle.Saas[name]
+		// Offers that the model already consumes under the same name are
+		// left alone.
+		if remoteApp := r.model.RemoteApplications[name]; remoteApp != nil {
+			if remoteApp.OfferURL != saasSpec.URL {
+				return nil, &SaasConflictError{
+					Name:        name,
+					URL:         saasSpec.URL,
+					ExistingURL: remoteApp.OfferURL,
+				}
+			}
+			continue
+		}
 		change := newConsumeOfferChange(ConsumeOfferParams{
 			URL:             saasSpec.URL,
 			ApplicationName: name,
@@ -507,18 +641,469 @@ func (r *resolver) handleOffers(addedApplications map[string]string, deployedBun
 			}, reqs...)
 			r.changes.add(change)
 
-			for user, access := range offerSpec.ACL {
+			var existingACL map[string]string
+			if existingApp := r.model.GetApplication(appName); updateOffer && existingApp != nil {
+				existingACL = existingApp.OfferACLs[offerName]
+			}
+			users := make([]string, 0, len(offerSpec.ACL))
+			for user := range offerSpec.ACL {
+				users = append(users, user)
+			}
+			sort.Strings(users)
+			for _, user := range users {
+				access := offerSpec.ACL[user]
+				if current, found := existingACL[user]; found && offerAccessIncludes(current, access) {
+					// The user already holds this access.
+					continue
+				}
 				r.changes.add(newGrantOfferAccessChange(GrantOfferAccessParams{
 					User:   user,
 					Access: access,
 					Offer:  offerName,
 				}, change.Id()))
 			}
+			if r.pruneOffers {
+				r.revokeOfferAccess(offerName, existingACL, offerSpec.ACL, change.Id())
+			}
 		}
 	}
 	return addedApplications, nil
 }
 
+// offerAccessLevels lists the offer access levels from the lowest to the
+// highest. Each level includes the ones below it.
+var offerAccessLevels = []string{"read", "consume", "admin"}
+
+func offerAccessLevel(access string) int {
+	for i, level := range offerAccessLevels {
+		if level == access {
+			return i
+		}
+	}
+	return -1
+}
+
+// offerAccessIncludes returns whether the current access level to an offer
+// includes the given one.
+func offerAccessIncludes(current, access string) bool {
+	if current == access {
+		return true
+	}
+	level := offerAccessLevel(access)
+	return level != -1 && offerAccessLevel(current) > level
+}
+
+// revokeOfferAccess populates the change set with "revokeOfferAccess"
+// records for the users whose access to the offer exceeds the bundle ACL.
+// Revoking a level leaves the user with the level below it, so users that
+// are missing from the bundle ACL have their "read" access revoked.
+func (r *resolver) revokeOfferAccess(offerName string, existingACL, bundleACL map[string]string, requires ...string) {
+	users := make([]string, 0, len(existingACL))
+	for user := range existingACL {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for _, user := range users {
+		current := existingACL[user]
+		access, found := bundleACL[user]
+		revoke := offerAccessLevels[0]
+		if found {
+			currentLevel, level := offerAccessLevel(current), offerAccessLevel(access)
+			if level == -1 || currentLevel <= level {
+				continue
+			}
+			revoke = offerAccessLevels[level+1]
+		}
+		r.changes.add(newRevokeOfferAccessChange(RevokeOfferAccessParams{
+			User:   user,
+			Access: revoke,
+			Offer:  offerName,
+		}, requires...))
+	}
+}
+
+// handleRemovedOffers populates the change set with "removeOffer" records
+// for the offers in the model that the bundle does not declare, including
+// all the offers of the applications missing from the bundle. Only the
+// offers of the applications missing from the bundle are removed when
+// just pruning applications. The returned map holds the ids of the changes
+// keyed by application name.
+func (r *resolver) handleRemovedOffers() map[string][]string {
+	names := make([]string, 0, len(r.model.Applications))
+	for name := range r.model.Applications {
+		names = append(names, name)
+	}
+	naturalsort.Sort(names)
+	removedOffers := make(map[string][]string)
+	for _, name := range names {
+		var declared map[string]*charm.OfferSpec
+		if application := r.bundle.Applications[name]; application != nil {
+			if !r.pruneOffers {
+				continue
+			}
+			declared = application.Offers
+		}
+		offers := append([]string(nil), r.model.Applications[name].Offers...)
+		sort.Strings(offers)
+		for _, offerName := range offers {
+			if _, found := declared[offerName]; found {
+				continue
+			}
+			change := newRemoveOfferChange(RemoveOfferParams{
+				Application: name,
+				OfferName:   offerName,
+			})
+			r.changes.add(change)
+			removedOffers[name] = append(removedOffers[name], change.Id())
+		}
+	}
+	return removedOffers
+}
+
+// handleRemovedUnits populates the change set with "removeUnit" records for
+// the applications that have more units deployed in the model than the
+// bundle asks for. The unit removal policy selects which units go. The
+// returned map holds the ids of the changes keyed by unit name.
+func (r *resolver) handleRemovedUnits() (map[string]string, error) {
+	policy := r.unitRemovalPolicy
+	if policy == nil {
+		policy = HighestUnitsFirst
+	}
+
+	names := make([]string, 0, len(r.bundle.Applications))
+	for name := range r.bundle.Applications {
+		names = append(names, name)
+	}
+	naturalsort.Sort(names)
+	removedUnits := make(map[string]string)
+	for _, name := range names {
+		application := r.bundle.Applications[name]
+		existingApp := r.model.GetApplication(name)
+		// The units of subordinate applications follow their principals,
+		// so num_units is never checked for them.
+		if existingApp == nil || len(existingApp.SubordinateTo) != 0 {
+			continue
+		}
+		excess := existingApp.unitCount() - application.NumUnits
+		if excess <= 0 {
+			continue
+		}
+
+		deployed := set.NewStrings()
+		for _, unit := range existingApp.Units {
+			if !existingApp.unitDying(unit) {
+				deployed.Add(unit.Name)
+			}
+		}
+		units := policy(r.model, name, application)
+		if len(units) < excess {
+			return nil, errors.Errorf("unit removal policy selected %d units of %s for removal, need %d", len(units), name, excess)
+		}
+		for _, unit := range units[:excess] {
+			if !deployed.Contains(unit.Name) {
+				return nil, errors.Errorf("unit removal policy selected %q which is not a live unit of %s", unit.Name, name)
+			}
+			change := newRemoveUnitChange(RemoveUnitParams{
+				Unit: unit.Name,
+			})
+			r.changes.add(change)
+			removedUnits[unit.Name] = change.Id()
+		}
+	}
+	return removedUnits, nil
+}
+
+// HighestUnitsFirst is a UnitRemovalPolicy that removes the units with the
+// highest unit numbers first. This is the default policy.
+func HighestUnitsFirst(model *Model, appName string, _ *charm.ApplicationSpec) []Unit {
+	return unitsByRemovalPreference(model.GetApplication(appName), nil)
+}
+
+// EmptyMachinesFirst is a UnitRemovalPolicy that first removes the units
+// whose machine would then host no units at all, so that the machine can be
+// removed too. Otherwise the highest unit numbers go first.
+func EmptyMachinesFirst(model *Model, appName string, _ *charm.ApplicationSpec) []Unit {
+	machineUnits := model.machineUnitCounts()
+	return unitsByRemovalPreference(model.GetApplication(appName), func(unit Unit) bool {
+		return machineUnits[unit.Machine] == 1
+	})
+}
+
+// UnplacedUnitsFirst is a UnitRemovalPolicy that first removes the units that
+// do not satisfy any of the application's `to:` placement directives, so
+// that the units the bundle places explicitly are kept. Otherwise the
+// highest unit numbers go first.
+func UnplacedUnitsFirst(model *Model, appName string, application *charm.ApplicationSpec) []Unit {
+	var placements []*charm.UnitPlacement
+	for _, to := range application.To {
+		// The bundle has been verified, so this shouldn't fail, but
+		// be paranoid about it anyway.
+		if placement, err := charm.ParsePlacement(to); err == nil {
+			placements = append(placements, placement)
+		}
+	}
+	return unitsByRemovalPreference(model.GetApplication(appName), func(unit Unit) bool {
+		for _, placement := range placements {
+			if model.unitSatisfiesPlacement(unit, placement) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// unitsByRemovalPreference returns the units of the application that are
+// not already dying, with the preferred units first. Within the preferred
+// and the other units, the highest unit numbers come first.
+func unitsByRemovalPreference(app *Application, preferred func(Unit) bool) []Unit {
+	if app == nil {
+		return nil
+	}
+	var units []Unit
+	for _, unit := range app.Units {
+		if !app.unitDying(unit) {
+			units = append(units, unit)
+		}
+	}
+	sort.SliceStable(units, func(i, j int) bool {
+		if preferred != nil {
+			if iPreferred, jPreferred := preferred(units[i]), preferred(units[j]); iPreferred != jPreferred {
+				return iPreferred
+			}
+		}
+		return unitNumber(units[i].Name) > unitNumber(units[j].Name)
+	})
+	return units
+}
+
+// handleRemovedRelations populates the change set with "removeRelation"
+// records for the relations in the model that the bundle does not declare,
+// except for the peer relations. These are the same relations that
+// BuildDiff reports as model additions. Only the relations of the
+// applications being removed are removed when just pruning applications.
+// The returned map holds, for each application, the ids of the changes
+// removing its relations.
+func (r *resolver) handleRemovedRelations() map[string][]string {
+	declared := make([]Relation, len(r.bundle.Relations))
+	for i, relation := range r.bundle.Relations {
+		declared[i] = relationFromEndpoints(relation)
+	}
+
+	seen := make(map[Relation]bool)
+	var removed []Relation
+	for _, original := range r.model.Relations {
+		relation := canonicalRelation(original)
+		if isPeerRelation(relation) || seen[relation] || relationDeclared(relation, declared) {
+			continue
+		}
+		if !r.pruneRelations && !r.applicationPruned(relation.App1) && !r.applicationPruned(relation.App2) {
+			continue
+		}
+		seen[relation] = true
+		removed = append(removed, relation)
+	}
+	sort.Slice(removed, relationLess(removed))
+
+	removedRelations := make(map[string][]string)
+	for _, relation := range removed {
+		change := newRemoveRelationChange(RemoveRelationParams{
+			Endpoint1: relation.App1 + ":" + relation.Endpoint1,
+			Endpoint2: relation.App2 + ":" + relation.Endpoint2,
+		})
+		r.changes.add(change)
+		removedRelations[relation.App1] = append(removedRelations[relation.App1], change.Id())
+		if relation.App2 != relation.App1 {
+			removedRelations[relation.App2] = append(removedRelations[relation.App2], change.Id())
+		}
+	}
+	return removedRelations
+}
+
+// relationDeclared reports whether the canonical model relation matches one
+// of the relations declared in the bundle. Bundles may omit the endpoint
+// names from relations, in which case any endpoint of the application
+// matches.
+func relationDeclared(relation Relation, declared []Relation) bool {
+	endpointMatches := func(declaredApp, declaredEndpoint, app, endpoint string) bool {
+		return declaredApp == app && (declaredEndpoint == "" || declaredEndpoint == endpoint)
+	}
+	for _, candidate := range declared {
+		if endpointMatches(candidate.App1, candidate.Endpoint1, relation.App1, relation.Endpoint1) &&
+			endpointMatches(candidate.App2, candidate.Endpoint2, relation.App2, relation.Endpoint2) {
+			return true
+		}
+		// Omitted endpoint names can change the canonical order of the
+		// declared relation, so check the other way around too.
+		if endpointMatches(candidate.App1, candidate.Endpoint1, relation.App2, relation.Endpoint2) &&
+			endpointMatches(candidate.App2, candidate.Endpoint2, relation.App1, relation.Endpoint1) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRemovedApplications populates the change set with "removeApplication"
+// records for the applications deployed in the model that the bundle no
+// longer describes. These are the same applications that BuildDiff reports
+// as missing from the bundle side, except for the ones already going away.
+// Each removal is ordered after the
+// removal of the relations the application takes part in and of its offers.
+// The returned map holds the ids of the changes keyed by application name.
+func (r *resolver) handleRemovedApplications(removedRelations, removedOffers map[string][]string) map[string]string {
+	names := make([]string, 0, len(r.model.Applications))
+	for name := range r.model.Applications {
+		if r.applicationPruned(name) {
+			names = append(names, name)
+		}
+	}
+	naturalsort.Sort(names)
+	removedApplications := make(map[string]string, len(names))
+	for _, name := range names {
+		requires := append([]string(nil), removedRelations[name]...)
+		requires = append(requires, removedOffers[name]...)
+		change := newRemoveApplicationChange(RemoveApplicationParams{
+			Application: name,
+		}, requires...)
+		r.changes.add(change)
+		removedApplications[name] = change.Id()
+	}
+	return removedApplications
+}
+
+// applicationPruned reports whether pruning removes the application from
+// the model: it is deployed but missing from the bundle, and not already
+// going away.
+func (r *resolver) applicationPruned(name string) bool {
+	if !r.pruneApplications {
+		return false
+	}
+	app := r.model.GetApplication(name)
+	_, found := r.bundle.Applications[name]
+	return app != nil && !found && !app.Life.isDying()
+}
+
+// handleRemovedMachines populates the change set with "removeMachines"
+// records for the machines and containers in the model that host no units
+// once the other changes are applied. Each removal is ordered after the
+// unit and application removals that empty the machine, and after the
+// removal of its containers. Machines that the machine map associates with
+// bundle machines are never removed.
+func (r *resolver) handleRemovedMachines(removedApplications, removedUnits map[string]string) {
+	kept := set.NewStrings()
+	for _, machineID := range r.model.MachineMap {
+		kept.Add(machineID)
+	}
+	for _, machineID := range r.machinesUsedByChanges() {
+		kept.Add(machineID)
+	}
+
+	requires := make(map[string][]string)
+	for appName, app := range r.model.Applications {
+		for _, unit := range app.Units {
+			changeID := removedApplications[appName]
+			if changeID == "" {
+				changeID = removedUnits[unit.Name]
+			}
+			switch {
+			case changeID != "":
+				requires[unit.Machine] = append(requires[unit.Machine], changeID)
+			case len(app.SubordinateTo) == 0:
+				// Subordinate units go away with their principals, so
+				// only the remaining principal units keep the machine.
+				kept.Add(unit.Machine)
+			}
+		}
+	}
+	// The machines hosting kept containers are kept too.
+	for _, machineID := range kept.Values() {
+		for parent := parentMachine(machineID); parent != ""; parent = parentMachine(parent) {
+			kept.Add(parent)
+		}
+	}
+
+	var removed []string
+	for machineID, machine := range r.model.Machines {
+		// Machines that are already going away are left alone.
+		if !kept.Contains(machineID) && names.IsValidMachine(machineID) && (machine == nil || !machine.Life.isDying()) {
+			removed = append(removed, machineID)
+		}
+	}
+	naturalsort.Sort(removed)
+	// Containers are removed before the machines hosting them.
+	sort.SliceStable(removed, func(i, j int) bool {
+		return strings.Count(removed[i], "/") > strings.Count(removed[j], "/")
+	})
+
+	removedMachines := make(map[string]string, len(removed))
+	for _, machineID := range removed {
+		deps := set.NewStrings(requires[machineID]...)
+		for containerID, changeID := range removedMachines {
+			if parentMachine(containerID) == machineID {
+				deps.Add(changeID)
+			}
+		}
+		change := newRemoveMachineChange(RemoveMachineParams{
+			Machine: machineID,
+		}, deps.SortedValues()...)
+		r.changes.add(change)
+		removedMachines[machineID] = change.Id()
+	}
+}
+
+// checkDyingEntities returns a DyingEntitiesError naming the bundle
+// applications that are dying or in error in the model, and the machines
+// that the changes place units or containers on although they are dying or
+// in error.
+func (r *resolver) checkDyingEntities() error {
+	var applications []string
+	for name := range r.bundle.Applications {
+		if !r.model.GetApplication(name).usable() {
+			applications = append(applications, name)
+		}
+	}
+	machines := set.NewStrings()
+	for _, machineID := range r.machinesUsedByChanges() {
+		// A container can't be used if its host is going away.
+		for id := machineID; id != ""; id = parentMachine(id) {
+			if !r.model.Machines[id].usable() {
+				machines.Add(id)
+			}
+		}
+	}
+	if len(applications) == 0 && machines.IsEmpty() {
+		return nil
+	}
+	return &DyingEntitiesError{
+		Applications: naturalsort.Sort(applications),
+		Machines:     naturalsort.Sort(machines.Values()),
+	}
+}
+
+// machinesUsedByChanges returns the ids of the existing machines that the
+// changes place new units or containers on.
+func (r *resolver) machinesUsedByChanges() []string {
+	var machines []string
+	addTarget := func(target string) {
+		// Existing machines are referred to by id, optionally prefixed by
+		// the container type, whereas new ones are placeholders.
+		if parts := strings.SplitN(target, ":", 2); len(parts) == 2 {
+			target = parts[1]
+		}
+		if target != "" && !strings.HasPrefix(target, "$") {
+			machines = append(machines, target)
+		}
+	}
+	for _, change := range r.changes.changes {
+		switch change := change.(type) {
+		case *AddUnitChange:
+			addTarget(change.Params.To)
+		case *AddMachineChange:
+			addTarget(change.Params.ParentId)
+		}
+	}
+	return machines
+}
+
 type unitProcessor struct {
 	add           func(Change)
 	existing      *Model
@@ -1167,6 +1752,73 @@ func (err *InconsistentMachineMapError) Error() string {
 	)
 }
 
+// DyingEntitiesError indicates that the bundle requires applications or
+// machines that are dying, dead or in error in the model.
+type DyingEntitiesError struct {
+	Applications []string
+	Machines     []string
+}
+
+func (err *DyingEntitiesError) Error() string {
+	var entities []string
+	if len(err.Applications) != 0 {
+		entities = append(entities, fmt.Sprintf("applications [%s]", strings.Join(err.Applications, ", ")))
+	}
+	if len(err.Machines) != 0 {
+		entities = append(entities, fmt.Sprintf("machines [%s]", strings.Join(err.Machines, ", ")))
+	}
+	return fmt.Sprintf("bundle requires entities that are dying or in error: %s", strings.Join(entities, ", "))
+}
+
+// SaasConflictError indicates that the bundle consumes an offer under a
+// name that the model already uses for a different offer.
+type SaasConflictError struct {
+	Name        string
+	URL         string
+	ExistingURL string
+}
+
+func (err *SaasConflictError) Error() string {
+	return fmt.Sprintf(
+		"cannot consume offer %q as %q: the model already consumes offer %q under that name",
+		err.URL,
+		err.Name,
+		err.ExistingURL,
+	)
+}
+
+// StorageChangeError indicates that the bundle changes the directives of
+// storage that the application already has, which cannot be done on a
+// deployed application.
+type StorageChangeError struct {
+	Application string
+	Storage     []string
+}
+
+func (err *StorageChangeError) Error() string {
+	return fmt.Sprintf(
+		"cannot change storage [%s] of deployed application %q: storage directives can only be set for new storage",
+		strings.Join(err.Storage, ", "),
+		err.Application,
+	)
+}
+
+// DeviceChangeError indicates that the bundle requests devices that differ
+// from the ones the application was deployed with, which cannot be changed
+// in place.
+type DeviceChangeError struct {
+	Application string
+	Devices     []string
+}
+
+func (err *DeviceChangeError) Error() string {
+	return fmt.Sprintf(
+		"cannot change devices [%s] of deployed application %q: devices can only be requested when deploying",
+		strings.Join(err.Devices, ", "),
+		err.Application,
+	)
+}
+
 func placeholder(changeID string) string {
 	return "$" + changeID
 }
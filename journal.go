@@ -0,0 +1,429 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// journalVersion is the version of the journal format.
+const journalVersion = 1
+
+// ChangeStatus is the status of a change recorded in a journal.
+type ChangeStatus string
+
+const (
+	// ChangeApplied is the status of the changes applied successfully.
+	ChangeApplied ChangeStatus = "applied"
+	// ChangeFailed is the status of the changes that failed. They are
+	// applied again when the plan is resumed.
+	ChangeFailed ChangeStatus = "failed"
+)
+
+// JournalEntry records the outcome of a change.
+type JournalEntry struct {
+	Change string       `json:"change"`
+	Status ChangeStatus `json:"status"`
+	// Result holds the result of an applied change: the charm URL,
+	// application name, machine id or unit name it produced.
+	Result string `json:"result,omitempty"`
+	// Machine holds the machine of the unit added by an applied change.
+	Machine string `json:"machine,omitempty"`
+	// Error holds the error of a failed change.
+	Error string `json:"error,omitempty"`
+}
+
+// journalHeader is the first line of a journal file.
+type journalHeader struct {
+	Version int `json:"version"`
+	// Plan is the fingerprint of the plan the journal is written for.
+	Plan string `json:"plan"`
+	// Changes holds the changes of the plan, so that it can be resumed
+	// without being computed again.
+	Changes []journalChange `json:"changes"`
+}
+
+// journalChange records a change of the plan in a journal header.
+type journalChange struct {
+	Id       string                 `json:"id"`
+	Method   string                 `json:"method"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+	Requires []string               `json:"requires,omitempty"`
+}
+
+// PlanChangedError is returned when a journal was written for another plan
+// than the one to apply.
+type PlanChangedError struct {
+	Path string
+}
+
+// Error implements error.
+func (err *PlanChangedError) Error() string {
+	return fmt.Sprintf("journal %q was written for another plan", err.Path)
+}
+
+// Journal persists the outcome of the changes of a plan to a local file,
+// one JSON entry per line, so that the plan can be resumed where it
+// stopped. A Journal is safe for concurrent use.
+type Journal struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]JournalEntry
+}
+
+// OpenJournal opens the journal file at the given path for the changes of
+// a plan, creating the file if it doesn't exist. The changes are recorded
+// in a new journal, so that the plan can later be resumed with
+// ResumeJournal. It returns a PlanChangedError if the journal was written
+// for another plan.
+func OpenJournal(path string, changes []Change) (*Journal, error) {
+	plan, err := journalChanges(changes)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	fingerprint, err := planFingerprint(plan)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	j, header, err := openJournal(path, os.O_CREATE)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch {
+	case header == nil:
+		err = j.write(journalHeader{Version: journalVersion, Plan: fingerprint, Changes: plan})
+	case header.Plan != fingerprint:
+		err = &PlanChangedError{Path: path}
+	}
+	if err != nil {
+		j.file.Close()
+		return nil, errors.Trace(err)
+	}
+	return j, nil
+}
+
+// ResumeJournal opens the existing journal file at the given path, and
+// returns it with the changes of the plan it was written for, so that the
+// plan can be resumed without being computed again. The descriptions of the
+// returned changes may lack the details only known while planning.
+func ResumeJournal(path string) (*Journal, []Change, error) {
+	j, header, err := openJournal(path, 0)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if header == nil {
+		j.file.Close()
+		return nil, nil, errors.NotValidf("empty journal %q", path)
+	}
+	changes := make([]Change, len(header.Changes))
+	for i, recorded := range header.Changes {
+		if changes[i], err = recorded.change(); err != nil {
+			j.file.Close()
+			return nil, nil, errors.Annotatef(err, "cannot read journal %q", path)
+		}
+	}
+	return j, changes, nil
+}
+
+// openJournal opens the journal file at the given path with the given
+// extra flags, and loads its entries. The returned header is nil if the
+// journal is empty.
+func openJournal(path string, flag int) (*Journal, *journalHeader, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|flag, 0600)
+	if os.IsNotExist(err) {
+		return nil, nil, errors.NotFoundf("journal %q", path)
+	}
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	j := &Journal{
+		path:    path,
+		file:    file,
+		entries: make(map[string]JournalEntry),
+	}
+	header, err := j.load()
+	if err != nil {
+		file.Close()
+		return nil, nil, errors.Trace(err)
+	}
+	return j, header, nil
+}
+
+// load reads the header and the entries of the journal. The returned header
+// is nil if the journal is empty.
+func (j *Journal) load() (*journalHeader, error) {
+	scanner := bufio.NewScanner(j.file)
+	// The header holds the whole plan.
+	scanner.Buffer(nil, 64*1024*1024)
+	if !scanner.Scan() {
+		return nil, errors.Trace(scanner.Err())
+	}
+	var header journalHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, errors.Annotatef(err, "cannot read journal %q", j.path)
+	}
+	if header.Version != journalVersion {
+		return nil, errors.NotSupportedf("journal %q version %d", j.path, header.Version)
+	}
+	// size is the size of the complete lines read.
+	size := int64(len(scanner.Bytes()) + 1)
+	var bad error
+	for scanner.Scan() {
+		if bad != nil {
+			// Only the last entry can be truncated by an interrupted write.
+			return nil, errors.Annotatef(bad, "cannot read journal %q", j.path)
+		}
+		var entry JournalEntry
+		if bad = json.Unmarshal(scanner.Bytes(), &entry); bad == nil {
+			j.entries[entry.Change] = entry
+			size += int64(len(scanner.Bytes()) + 1)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if bad != nil {
+		// Drop the truncated entry, so that the next one is appended to
+		// the complete ones.
+		return &header, errors.Trace(j.file.Truncate(size))
+	}
+	info, err := j.file.Stat()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if info.Size() < size {
+		// The last entry lacks its line terminator.
+		_, err = j.file.Write([]byte("\n"))
+	}
+	return &header, errors.Trace(err)
+}
+
+// write appends the value as a JSON line and syncs the file.
+func (j *Journal) write(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(j.file.Sync())
+}
+
+// Path returns the path of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Entry returns the last entry recorded for the change with the given id,
+// and whether there is one.
+func (j *Journal) Entry(id string) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, found := j.entries[id]
+	return entry, found
+}
+
+// Applied reports whether the change with the given id was applied.
+func (j *Journal) Applied(id string) bool {
+	entry, _ := j.Entry(id)
+	return entry.Status == ChangeApplied
+}
+
+// Record appends the entry to the journal.
+func (j *Journal) Record(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.write(entry); err != nil {
+		return errors.Annotatef(err, "cannot write journal %q", j.path)
+	}
+	j.entries[entry.Change] = entry
+	return nil
+}
+
+// Restore records the results of the applied changes in the resolver, so
+// that the changes still to apply can refer to them.
+func (j *Journal) Restore(r *Resolver) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, entry := range j.entries {
+		if entry.Status != ChangeApplied || entry.Result == "" {
+			continue
+		}
+		if entry.Machine != "" {
+			r.RecordUnit(id, entry.Result, entry.Machine)
+		} else {
+			r.Record(id, entry.Result)
+		}
+	}
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return errors.Trace(j.file.Close())
+}
+
+// journalChanges returns the changes as recorded in a journal header.
+func journalChanges(changes []Change) ([]journalChange, error) {
+	result := make([]journalChange, len(changes))
+	for i, change := range changes {
+		args, err := change.Args()
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot encode change %q", change.Id())
+		}
+		result[i] = journalChange{
+			Id:       change.Id(),
+			Method:   change.Method(),
+			Args:     args,
+			Requires: change.Requires(),
+		}
+	}
+	return result, nil
+}
+
+// planFingerprint returns a hash of the ids, methods, arguments and
+// requirements of the changes.
+func planFingerprint(changes []journalChange) (string, error) {
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, change := range changes {
+		err := encoder.Encode([]interface{}{
+			change.Id,
+			change.Method,
+			change.Args,
+			change.Requires,
+		})
+		if err != nil {
+			return "", errors.Annotatef(err, "cannot encode change %q", change.Id)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// change returns the recorded change.
+func (recorded journalChange) change() (Change, error) {
+	args, err := json.Marshal(recorded.Args)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	requires := recorded.Requires
+	var change Change
+	switch recorded.Method {
+	case "addCharm":
+		var params AddCharmParams
+		err = json.Unmarshal(args, &params)
+		change = newAddCharmChange(params, requires...)
+	case "upgradeCharm":
+		var params UpgradeCharmParams
+		err = json.Unmarshal(args, &params)
+		change = newUpgradeCharm(params, requires...)
+	case "deploy":
+		var params AddApplicationParams
+		err = json.Unmarshal(args, &params)
+		change = newAddApplicationChange(params, requires...)
+	case "addMachines":
+		var params AddMachineParams
+		err = json.Unmarshal(args, &params)
+		change = newAddMachineChange(params, requires...)
+	case "addUnit":
+		var params AddUnitParams
+		err = json.Unmarshal(args, &params)
+		change = newAddUnitChange(params, requires...)
+	case "addRelation":
+		var params AddRelationParams
+		err = json.Unmarshal(args, &params)
+		change = newAddRelationChange(params, requires...)
+	case "expose":
+		var params ExposeParams
+		err = json.Unmarshal(args, &params)
+		change = newExposeChange(params, requires...)
+	case "unexpose":
+		var params UnexposeParams
+		err = json.Unmarshal(args, &params)
+		change = newUnexposeChange(params, requires...)
+	case "scale":
+		var params ScaleParams
+		err = json.Unmarshal(args, &params)
+		change = newScaleChange(params, requires...)
+	case "setAnnotations":
+		var params SetAnnotationsParams
+		err = json.Unmarshal(args, &params)
+		change = newSetAnnotationsChange(params, requires...)
+	case "setOptions":
+		var params SetOptionsParams
+		err = json.Unmarshal(args, &params)
+		change = newSetOptionsChange(params, requires...)
+	case "setConstraints":
+		var params SetConstraintsParams
+		err = json.Unmarshal(args, &params)
+		change = newSetConstraintsChange(params, requires...)
+	case "addStorage":
+		var params AddStorageParams
+		err = json.Unmarshal(args, &params)
+		change = newAddStorageChange(params, requires...)
+	case "bind":
+		var params BindParams
+		err = json.Unmarshal(args, &params)
+		change = newBindChange(params, requires...)
+	case "setTrust":
+		var params SetTrustParams
+		err = json.Unmarshal(args, &params)
+		change = newSetTrustChange(params, requires...)
+	case "createOffer":
+		var params CreateOfferParams
+		err = json.Unmarshal(args, &params)
+		change = newCreateOfferChange(params, requires...)
+	case "consumeOffer":
+		var params ConsumeOfferParams
+		err = json.Unmarshal(args, &params)
+		change = newConsumeOfferChange(params, requires...)
+	case "grantOfferAccess":
+		var params GrantOfferAccessParams
+		err = json.Unmarshal(args, &params)
+		change = newGrantOfferAccessChange(params, requires...)
+	case "revokeOfferAccess":
+		var params RevokeOfferAccessParams
+		err = json.Unmarshal(args, &params)
+		change = newRevokeOfferAccessChange(params, requires...)
+	case "removeOffer":
+		var params RemoveOfferParams
+		err = json.Unmarshal(args, &params)
+		change = newRemoveOfferChange(params, requires...)
+	case "removeApplication":
+		var params RemoveApplicationParams
+		err = json.Unmarshal(args, &params)
+		change = newRemoveApplicationChange(params, requires...)
+	case "removeUnit":
+		var params RemoveUnitParams
+		err = json.Unmarshal(args, &params)
+		change = newRemoveUnitChange(params, requires...)
+	case "removeMachines":
+		var params RemoveMachineParams
+		err = json.Unmarshal(args, &params)
+		change = newRemoveMachineChange(params, requires...)
+	case "removeRelation":
+		var params RemoveRelationParams
+		err = json.Unmarshal(args, &params)
+		change = newRemoveRelationChange(params, requires...)
+	default:
+		return nil, errors.NotSupportedf("change %q method %q", recorded.Id, recorded.Method)
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot decode change %q", recorded.Id)
+	}
+	change.setId(recorded.Id)
+	return change, nil
+}
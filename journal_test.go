@@ -0,0 +1,295 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/charm/v9"
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/bundlechanges/v5"
+)
+
+type journalSuite struct{}
+
+var _ = gc.Suite(&journalSuite{})
+
+func (s *journalSuite) execute(c *gc.C, backend bundlechanges.Backend, journal *bundlechanges.Journal, changes []bundlechanges.Change) (map[string]string, error) {
+	executor, err := bundlechanges.NewExecutor(bundlechanges.ExecutorConfig{
+		Backend: backend,
+		Logger:  loggo.GetLogger("bundlechanges"),
+		Journal: journal,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return executor.Execute(changes)
+}
+
+// checkResumed checks that the changes of a resumed plan match the planned
+// ones.
+func (s *journalSuite) checkResumed(c *gc.C, resumed, changes []bundlechanges.Change) {
+	c.Assert(resumed, gc.HasLen, len(changes))
+	for i, change := range resumed {
+		c.Check(change, gc.FitsTypeOf, changes[i])
+		c.Check(change.Id(), gc.Equals, changes[i].Id())
+		c.Check(change.Method(), gc.Equals, changes[i].Method())
+		c.Check(change.Requires(), jc.DeepEquals, changes[i].Requires())
+		args, err := change.Args()
+		c.Assert(err, jc.ErrorIsNil)
+		expectedArgs, err := changes[i].Args()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(args, jc.DeepEquals, expectedArgs)
+	}
+}
+
+func (s *journalSuite) TestResume(c *gc.C) {
+	data, changes := bundlePlan(c, executorBundle, nil)
+	path := filepath.Join(c.MkDir(), "journal")
+	backend := bundlechanges.NewFakeBackend(nil)
+	backend.SetError("AddRelation", errors.New("boom"))
+
+	journal, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.execute(c, backend, journal, changes)
+	c.Assert(err, gc.ErrorMatches, `cannot apply change "addRelation-[0-9]+": boom`)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+	applied := len(backend.Calls()) - 1
+
+	// The plan is resumed with the change that failed, without being
+	// computed again.
+	backend.SetError("AddRelation", nil)
+	journal, resumed, err := bundlechanges.ResumeJournal(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer journal.Close()
+	s.checkResumed(c, resumed, changes)
+	results, err := s.execute(c, backend, journal, resumed)
+	c.Assert(err, jc.ErrorIsNil)
+	calls := backend.Calls()
+	c.Assert(calls, gc.HasLen, len(changes)+1)
+	c.Check(calls[applied].Method, gc.Equals, "AddRelation")
+	c.Check(calls[applied+1].Method, gc.Equals, "AddRelation")
+	c.Check(results["addCharm-0"], gc.Equals, "cs:django-4")
+
+	for _, change := range changes {
+		c.Check(journal.Applied(change.Id()), jc.IsTrue, gc.Commentf("change %s", change.Id()))
+	}
+	diff, err := bundlechanges.BuildDiff(bundlechanges.DiffConfig{
+		Bundle:             data,
+		Model:              backend.Model(),
+		IncludeAnnotations: true,
+		Logger:             loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(diff.Empty(), jc.IsTrue, gc.Commentf("diff: %#v", diff))
+}
+
+func (s *journalSuite) TestResumeChangesToExistingApplication(c *gc.C) {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        applications:
+            django:
+                charm: cs:django-5
+                trust: true
+                num_units: 1
+                options:
+                    debug: true
+                    workers: 4
+                storage:
+                    data: ebs,10G
+                    logs: ebs,1G
+                bindings:
+                    "": beta
+                exposed-endpoints:
+                    website:
+                        expose-to-cidrs: [0.0.0.0/0]
+                offers:
+                    web:
+                        endpoints: [website]
+                        acl:
+                            bob: consume
+        `))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Verify(nil, nil, nil), jc.ErrorIsNil)
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model: &bundlechanges.Model{
+			Applications: map[string]*bundlechanges.Application{
+				"django": {
+					Charm:            "cs:django-4",
+					Storage:          map[string]string{"data": "ebs,10G"},
+					EndpointBindings: map[string]string{"": "alpha"},
+					Exposed:          true,
+					ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+						"admin": {ExposeToCIDRs: []string{"0.0.0.0/0"}},
+					},
+					Units: []bundlechanges.Unit{
+						{Name: "django/0", Machine: "0"},
+						{Name: "django/1", Machine: "1"},
+					},
+				},
+				"mysql": {
+					Charm:  "cs:mysql-58",
+					Offers: []string{"db"},
+				},
+			},
+			Machines: map[string]*bundlechanges.Machine{
+				"0": {ID: "0"},
+				"1": {ID: "1"},
+			},
+			Relations: []bundlechanges.Relation{{
+				App1: "django", Endpoint1: "db", App2: "mysql", Endpoint2: "db",
+			}},
+		},
+		Logger: loggo.GetLogger("bundlechanges"),
+		Prune:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	journal, resumed, err := bundlechanges.ResumeJournal(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer journal.Close()
+	s.checkResumed(c, resumed, changes)
+}
+
+func (s *journalSuite) TestEntries(c *gc.C) {
+	_, changes := bundlePlan(c, executorBundle, nil)
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Record(bundlechanges.JournalEntry{
+		Change: "addUnit-9",
+		Status: bundlechanges.ChangeFailed,
+		Error:  "boom",
+	}), jc.ErrorIsNil)
+	c.Assert(journal.Record(bundlechanges.JournalEntry{
+		Change:  "addUnit-9",
+		Status:  bundlechanges.ChangeApplied,
+		Result:  "django/0",
+		Machine: "0",
+	}), jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	journal, err = bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	defer journal.Close()
+	entry, found := journal.Entry("addUnit-9")
+	c.Assert(found, jc.IsTrue)
+	c.Assert(entry, jc.DeepEquals, bundlechanges.JournalEntry{
+		Change:  "addUnit-9",
+		Status:  bundlechanges.ChangeApplied,
+		Result:  "django/0",
+		Machine: "0",
+	})
+	_, found = journal.Entry("addCharm-0")
+	c.Assert(found, jc.IsFalse)
+
+	r := bundlechanges.NewResolver()
+	journal.Restore(r)
+	c.Assert(r.Results(), jc.DeepEquals, map[string]string{"addUnit-9": "django/0"})
+}
+
+func (s *journalSuite) TestTruncatedEntry(c *gc.C) {
+	_, changes := bundlePlan(c, executorBundle, nil)
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Record(bundlechanges.JournalEntry{
+		Change: "addCharm-0",
+		Status: bundlechanges.ChangeApplied,
+		Result: "cs:django-4",
+	}), jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	// Simulate an interrupted write.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = f.WriteString(`{"change":"deploy-1","sta`)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.Close(), jc.ErrorIsNil)
+
+	journal, err = bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Applied("addCharm-0"), jc.IsTrue)
+	c.Assert(journal.Applied("deploy-1"), jc.IsFalse)
+	c.Assert(journal.Record(bundlechanges.JournalEntry{
+		Change: "deploy-1",
+		Status: bundlechanges.ChangeApplied,
+		Result: "django",
+	}), jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	journal, err = bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	defer journal.Close()
+	c.Assert(journal.Applied("deploy-1"), jc.IsTrue)
+}
+
+func (s *journalSuite) TestPlanChanged(c *gc.C) {
+	_, changes := bundlePlan(c, executorBundle, nil)
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	_, err = bundlechanges.OpenJournal(path, changes[:len(changes)-1])
+	c.Assert(err, gc.ErrorMatches, `journal ".*" was written for another plan`)
+	c.Assert(errors.Cause(err), jc.DeepEquals, &bundlechanges.PlanChangedError{Path: path})
+}
+
+func (s *journalSuite) TestPlanChangedArgs(c *gc.C) {
+	model := &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Charm:     "cs:django-4",
+				Resources: map[string]int{"data": 2},
+			},
+		},
+	}
+	_, changes := bundlePlan(c, `
+applications:
+    django:
+        charm: cs:django-4
+        resources:
+            data: 3
+`, model)
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	// Only the resource revision differs.
+	_, changes = bundlePlan(c, `
+applications:
+    django:
+        charm: cs:django-4
+        resources:
+            data: 4
+`, model)
+	_, err = bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, gc.ErrorMatches, `journal ".*" was written for another plan`)
+}
+
+func (s *journalSuite) TestResumeMissingJournal(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "journal")
+	_, _, err := bundlechanges.ResumeJournal(path)
+	c.Assert(err, gc.ErrorMatches, `journal ".*" not found`)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *journalSuite) TestInvalidJournal(c *gc.C) {
+	_, changes := bundlePlan(c, executorBundle, nil)
+	path := filepath.Join(c.MkDir(), "journal")
+	c.Assert(ioutil.WriteFile(path, []byte("not a journal\n"), 0600), jc.ErrorIsNil)
+	_, err := bundlechanges.OpenJournal(path, changes)
+	c.Assert(err, gc.ErrorMatches, `cannot read journal ".*": .*`)
+}
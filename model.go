@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/juju/charm/v9"
 	"github.com/juju/collections/set"
@@ -17,43 +18,211 @@ import (
 
 const kubernetes = "kubernetes"
 
-// Model represents the existing deployment if any.
+// Model represents the existing deployment if any. It can be marshalled as
+// YAML or JSON, leaving out the function fields and the logger.
 type Model struct {
-	Applications map[string]*Application
-	Machines     map[string]*Machine
-	Relations    []Relation
+	Applications map[string]*Application `yaml:"applications,omitempty" json:"applications,omitempty"`
+	Machines     map[string]*Machine     `yaml:"machines,omitempty" json:"machines,omitempty"`
+	Relations    []Relation              `yaml:"relations,omitempty" json:"relations,omitempty"`
+
+	// RemoteApplications holds the offers consumed by the model, keyed by
+	// the name of the remote application. When nil, the consumed offers
+	// are not known and are left out of bundle diffs.
+	RemoteApplications map[string]*RemoteApplication `yaml:"remote_applications,omitempty" json:"remote_applications,omitempty"`
+
+	// Spaces holds the network spaces of the model, keyed by name. When
+	// nil, the spaces referred to by the bundle are not validated.
+	Spaces map[string]*Space `yaml:"spaces,omitempty" json:"spaces,omitempty"`
 
 	// ConstraintsEqual is a function that is able to determine if two
 	// string values defining constraints are equal. This is to avoid a
 	// hard dependency on the juju constraints package.
-	ConstraintsEqual func(string, string) bool
+	ConstraintsEqual func(string, string) bool `yaml:"-" json:"-"`
 
 	// ConstraintsGetter is a function that is able to extract a constraint
 	// for inspection.
-	ConstraintGetter ConstraintGetter
+	ConstraintGetter ConstraintGetter `yaml:"-" json:"-"`
 
 	// Sequence holds a map of names to the next "number" that relates
 	// to the unit or machine. The keys are "application-<name>", the string
 	// "machine", or "machine-id/c" where n is a machine id, and c is a
 	// container type.
-	Sequence map[string]int
+	Sequence map[string]int `yaml:"sequence,omitempty" json:"sequence,omitempty"`
 
 	// The Sequence map isn't touched during the processing of of bundle
 	// changes, but we need to keep track, so a copy is made.
 	sequence map[string]int
 
 	// This is a mapping of existing machines to machines in the bundle.
-	MachineMap map[string]string
+	MachineMap map[string]string `yaml:"machine_map,omitempty" json:"machine_map,omitempty"`
 
 	logger Logger
 }
 
+// RemoteApplication represents an offer consumed by the model.
+type RemoteApplication struct {
+	Name     string `yaml:"name,omitempty" json:"name,omitempty"`
+	OfferURL string `yaml:"offer_url,omitempty" json:"offer_url,omitempty"`
+}
+
+// Space represents a network space of the model.
+type Space struct {
+	Name    string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Subnets []string `yaml:"subnets,omitempty" json:"subnets,omitempty"` // The CIDRs of the subnets in the space.
+}
+
+// Life describes the lifecycle of an entity in the model. An empty Life is
+// considered alive.
+type Life string
+
+const (
+	// Alive entities are in use.
+	Alive Life = "alive"
+	// Dying entities are being removed.
+	Dying Life = "dying"
+	// Dead entities are removed, but not yet cleaned up.
+	Dead Life = "dead"
+)
+
+// isDying returns whether the entity is going away.
+func (l Life) isDying() bool {
+	return l == Dying || l == Dead
+}
+
+// SpaceReference describes a reference to a space made by the bundle.
+type SpaceReference struct {
+	Space string
+	// Application or Machine names the bundle entity referring to the space.
+	Application string
+	Machine     string
+	// Usage is one of "binding", "expose" or "constraints".
+	Usage string
+	// Endpoint is the endpoint bound or exposed to the space, "" being
+	// the default binding or all the endpoints.
+	Endpoint string
+}
+
+func (ref SpaceReference) String() string {
+	entity := fmt.Sprintf("machine %q", ref.Machine)
+	if ref.Application != "" {
+		entity = fmt.Sprintf("application %q", ref.Application)
+	}
+	switch {
+	case ref.Usage == "constraints":
+		return fmt.Sprintf("space %q in constraints of %s", ref.Space, entity)
+	case ref.Endpoint == "":
+		return fmt.Sprintf("space %q in %s of %s", ref.Space, ref.Usage, entity)
+	}
+	return fmt.Sprintf("space %q in %s of endpoint %q of %s", ref.Space, ref.Usage, ref.Endpoint, entity)
+}
+
+// UnknownSpacesError indicates that the bundle refers to spaces that do
+// not exist in the model.
+type UnknownSpacesError struct {
+	References []SpaceReference
+}
+
+func (err *UnknownSpacesError) Error() string {
+	refs := make([]string, len(err.References))
+	for i, ref := range err.References {
+		refs[i] = ref.String()
+	}
+	return fmt.Sprintf("bundle refers to unknown spaces: %s", strings.Join(refs, ", "))
+}
+
+// validateSpaces returns an UnknownSpacesError if the endpoint bindings,
+// the exposed endpoints or the constraints of the bundle refer to spaces
+// that are not in the model. Nothing is checked if the spaces of the model
+// are not known.
+func (m *Model) validateSpaces(bundle *charm.BundleData) error {
+	if m.Spaces == nil {
+		return nil
+	}
+	var unknown []SpaceReference
+	check := func(ref SpaceReference) {
+		if _, found := m.Spaces[ref.Space]; !found {
+			unknown = append(unknown, ref)
+		}
+	}
+	appNames := make([]string, 0, len(bundle.Applications))
+	for name := range bundle.Applications {
+		appNames = append(appNames, name)
+	}
+	for _, name := range naturalsort.Sort(appNames) {
+		application := bundle.Applications[name]
+		endpoints := make([]string, 0, len(application.EndpointBindings))
+		for endpoint := range application.EndpointBindings {
+			endpoints = append(endpoints, endpoint)
+		}
+		sort.Strings(endpoints)
+		for _, endpoint := range endpoints {
+			check(SpaceReference{
+				Space:       application.EndpointBindings[endpoint],
+				Application: name,
+				Usage:       "binding",
+				Endpoint:    endpoint,
+			})
+		}
+		endpoints = make([]string, 0, len(application.ExposedEndpoints))
+		for endpoint := range application.ExposedEndpoints {
+			endpoints = append(endpoints, endpoint)
+		}
+		sort.Strings(endpoints)
+		for _, endpoint := range endpoints {
+			for _, space := range application.ExposedEndpoints[endpoint].ExposeToSpaces {
+				check(SpaceReference{
+					Space:       space,
+					Application: name,
+					Usage:       "expose",
+					Endpoint:    endpoint,
+				})
+			}
+		}
+		for _, space := range constraintSpaces(application.Constraints) {
+			check(SpaceReference{Space: space, Application: name, Usage: "constraints"})
+		}
+	}
+	machineIDs := make([]string, 0, len(bundle.Machines))
+	for id := range bundle.Machines {
+		machineIDs = append(machineIDs, id)
+	}
+	for _, id := range naturalsort.Sort(machineIDs) {
+		if machine := bundle.Machines[id]; machine != nil {
+			for _, space := range constraintSpaces(machine.Constraints) {
+				check(SpaceReference{Space: space, Machine: id, Usage: "constraints"})
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return &UnknownSpacesError{References: unknown}
+}
+
+// constraintSpaces returns the spaces, whether required or forbidden,
+// listed by the spaces constraint of the given constraints.
+func constraintSpaces(constraints string) []string {
+	var spaces []string
+	for _, constraint := range strings.Fields(constraints) {
+		value := strings.TrimPrefix(constraint, "spaces=")
+		if value == constraint {
+			continue
+		}
+		for _, space := range strings.Split(value, ",") {
+			if space = strings.TrimPrefix(space, "^"); space != "" {
+				spaces = append(spaces, space)
+			}
+		}
+	}
+	return spaces
+}
+
 // Relation holds the information between two releations.
 type Relation struct {
-	App1      string
-	Endpoint1 string
-	App2      string
-	Endpoint2 string
+	App1      string `yaml:"app1,omitempty" json:"app1,omitempty"`
+	Endpoint1 string `yaml:"endpoint1,omitempty" json:"endpoint1,omitempty"`
+	App2      string `yaml:"app2,omitempty" json:"app2,omitempty"`
+	Endpoint2 string `yaml:"endpoint2,omitempty" json:"endpoint2,omitempty"`
 }
 
 func (m *Model) pretty() string {
@@ -64,17 +233,22 @@ func (m *Model) pretty() string {
 }
 
 func (m *Model) initializeSequence() {
-	m.sequence = make(map[string]int)
-	if m.Sequence != nil {
-		for key, value := range m.Sequence {
-			m.sequence[key] = value
-		}
-		// We assume that if the mapping was specified, a complete mapping was
-		// specified.
+	if m.Sequence == nil {
+		m.sequence = m.inferSequence()
 		return
 	}
-	// Work to infer the mapping.
+	// We assume that if the mapping was specified, a complete mapping was
+	// specified.
+	m.sequence = make(map[string]int)
+	for key, value := range m.Sequence {
+		m.sequence[key] = value
+	}
+}
 
+// inferSequence returns the sequence following the highest unit numbers and
+// machine ids of the model.
+func (m *Model) inferSequence() map[string]int {
+	sequence := make(map[string]int)
 	for appName, app := range m.Applications {
 		for _, unit := range app.Units {
 			// This is pure paranoia, to avoid panics.
@@ -84,8 +258,8 @@ func (m *Model) initializeSequence() {
 			u := names.NewUnitTag(unit.Name)
 			unitNumber := u.Number()
 			key := "application-" + appName
-			if existing := m.sequence[key]; existing <= unitNumber {
-				m.sequence[key] = unitNumber + 1
+			if existing := sequence[key]; existing <= unitNumber {
+				sequence[key] = unitNumber + 1
 			}
 		}
 	}
@@ -102,10 +276,11 @@ func (m *Model) initializeSequence() {
 		if containerType := tag.ContainerType(); containerType != "" {
 			key = "machine-" + tag.Parent().Id() + "/" + containerType
 		}
-		if existing := m.sequence[key]; existing <= n {
-			m.sequence[key] = n + 1
+		if existing := sequence[key]; existing <= n {
+			sequence[key] = n + 1
 		}
 	}
+	return sequence
 }
 
 func (m *Model) nextMachine() string {
@@ -153,6 +328,15 @@ func topLevelMachine(machineID string) string {
 	return topLevelMachine(tag.Parent().Id())
 }
 
+// parentMachine returns the id of the machine hosting the given container,
+// or the empty string if the machine is not a container.
+func parentMachine(machineID string) string {
+	if !names.IsContainerMachine(machineID) {
+		return ""
+	}
+	return names.NewMachineTag(machineID).Parent().Id()
+}
+
 // InferMachineMap looks at all the machines defined in the bundle
 // and infers their mapping to the existing machine.
 // This method assumes that the units of an application are sorted
@@ -198,44 +382,83 @@ func (m *Model) getUnitMachine(appName string, index int) string {
 
 // Application represents an existing charm deployed in the model.
 type Application struct {
-	Name             string
-	Charm            string // The charm URL.
-	Scale            int
-	Options          map[string]interface{}
-	Annotations      map[string]string
-	Constraints      string // TODO: not updated yet.
-	Exposed          bool
-	ExposedEndpoints map[string]ExposedEndpoint
-	SubordinateTo    []string
-	Series           string
-	Channel          string
-	Revision         int
-	Placement        string
-	Offers           []string
-	// TODO: handle changes in:
-	//   storage
-
-	Units []Unit
+	Name             string                     `yaml:"name,omitempty" json:"name,omitempty"`
+	Charm            string                     `yaml:"charm,omitempty" json:"charm,omitempty"` // The charm URL.
+	Scale            int                        `yaml:"scale,omitempty" json:"scale,omitempty"`
+	Options          map[string]interface{}     `yaml:"options,omitempty" json:"options,omitempty"`
+	Annotations      map[string]string          `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+	Constraints      string                     `yaml:"constraints,omitempty" json:"constraints,omitempty"` // TODO: not updated yet.
+	Exposed          bool                       `yaml:"exposed,omitempty" json:"exposed,omitempty"`
+	Trust            *bool                      `yaml:"trust,omitempty" json:"trust,omitempty"` // Nil when the trust is not known.
+	ExposedEndpoints map[string]ExposedEndpoint `yaml:"exposed_endpoints,omitempty" json:"exposed_endpoints,omitempty"`
+	SubordinateTo    []string                   `yaml:"subordinate_to,omitempty" json:"subordinate_to,omitempty"`
+	Series           string                     `yaml:"series,omitempty" json:"series,omitempty"`
+	Channel          string                     `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Revision         int                        `yaml:"revision,omitempty" json:"revision,omitempty"`
+	Placement        string                     `yaml:"placement,omitempty" json:"placement,omitempty"`
+	Offers           []string                   `yaml:"offers,omitempty" json:"offers,omitempty"`
+	Life             Life                       `yaml:"life,omitempty" json:"life,omitempty"`
+	Status           string                     `yaml:"status,omitempty" json:"status,omitempty"`                       // The application status, such as "error".
+	Storage          map[string]string          `yaml:"storage,omitempty" json:"storage,omitempty"`                     // Storage directives keyed by store name.
+	Devices          map[string]string          `yaml:"devices,omitempty" json:"devices,omitempty"`                     // Device constraints keyed by device name.
+	EndpointBindings map[string]string          `yaml:"endpoint_bindings,omitempty" json:"endpoint_bindings,omitempty"` // Spaces keyed by endpoint, "" is the default space.
+	Resources        map[string]int             `yaml:"resources,omitempty" json:"resources,omitempty"`                 // Resource revisions keyed by resource name.
+	LocalResources   map[string]string          `yaml:"local_resources,omitempty" json:"local_resources,omitempty"`     // Paths of the uploaded resources, when known.
+	// OfferEndpoints holds the offered endpoints keyed by offer name.
+	OfferEndpoints map[string][]string `yaml:"offer_endpoints,omitempty" json:"offer_endpoints,omitempty"`
+	// OfferACLs holds the offer access levels keyed by offer name and user.
+	OfferACLs map[string]map[string]string `yaml:"offer_acls,omitempty" json:"offer_acls,omitempty"`
+	// UnitLife holds the life of the units keyed by unit name. The units
+	// not listed are alive.
+	UnitLife map[string]Life `yaml:"unit_life,omitempty" json:"unit_life,omitempty"`
+	// UnitStatus holds the workload status of the units keyed by unit name.
+	UnitStatus map[string]string `yaml:"unit_status,omitempty" json:"unit_status,omitempty"`
+
+	Units []Unit `yaml:"units,omitempty" json:"units,omitempty"`
 }
 
 // ExposedEndpoint encapsulates the expose-related parameters for a
 // particular endpoint.
 type ExposedEndpoint struct {
-	ExposeToSpaces []string
-	ExposeToCIDRs  []string
+	ExposeToSpaces []string `yaml:"expose_to_spaces,omitempty" json:"expose_to_spaces,omitempty"`
+	ExposeToCIDRs  []string `yaml:"expose_to_cidrs,omitempty" json:"expose_to_cidrs,omitempty"`
 }
 
 // Unit represents a unit in the model.
 type Unit struct {
-	Name    string
-	Machine string
+	Name    string `yaml:"name,omitempty" json:"name,omitempty"`
+	Machine string `yaml:"machine,omitempty" json:"machine,omitempty"`
 }
 
 // Machine represents an existing machine in the model.
 type Machine struct {
-	ID          string
-	Series      string
-	Annotations map[string]string
+	ID          string            `yaml:"id,omitempty" json:"id,omitempty"`
+	Series      string            `yaml:"series,omitempty" json:"series,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+	Constraints string            `yaml:"constraints,omitempty" json:"constraints,omitempty"`
+
+	// ContainerType and ParentID are only set for containers, such as
+	// "lxd" and "0" for the container "0/lxd/1".
+	ContainerType string `yaml:"container_type,omitempty" json:"container_type,omitempty"`
+	ParentID      string `yaml:"parent_id,omitempty" json:"parent_id,omitempty"`
+
+	Life   Life   `yaml:"life,omitempty" json:"life,omitempty"`
+	Status string `yaml:"status,omitempty" json:"status,omitempty"` // The machine agent status, such as "error".
+}
+
+// usable returns whether new units and containers can be placed on the
+// machine. Unknown machines are assumed to be usable.
+func (m *Machine) usable() bool {
+	return m == nil || (!m.Life.isDying() && m.Status != "error")
+}
+
+// containerType returns the container type of the machine, falling back
+// to the one in its id when it isn't set.
+func (m *Machine) containerType() string {
+	if m.ContainerType != "" || !names.IsContainerMachine(m.ID) {
+		return m.ContainerType
+	}
+	return names.NewMachineTag(m.ID).ContainerType()
 }
 
 func (m *Model) hasCharm(charm string) bool {
@@ -289,7 +512,13 @@ func (m *Model) unitMachinesWithoutApp(sourceApp, targetApp, container string) [
 	target := m.GetApplication(targetApp)
 	machines := set.NewStrings()
 	for _, unit := range source.Units {
-		machines.Add(topLevelMachine(unit.Machine))
+		machine := topLevelMachine(unit.Machine)
+		// Don't colocate with units or on machines that are going away
+		// or in error.
+		if !source.unitUsable(unit) || !m.Machines[machine].usable() {
+			continue
+		}
+		machines.Add(machine)
 	}
 	if target != nil {
 		for _, unit := range target.Units {
@@ -369,11 +598,148 @@ func (m *Model) getAppUnitOnMachine(machine, appName, containerType string) stri
 	return ""
 }
 
+// machineUnitCounts returns the number of principal units hosted on each
+// machine of the model. Subordinate units are not counted, as they go away
+// with their principals, and neither are dying units.
+func (m *Model) machineUnitCounts() map[string]int {
+	result := make(map[string]int)
+	for _, app := range m.Applications {
+		if len(app.SubordinateTo) != 0 {
+			continue
+		}
+		for _, unit := range app.Units {
+			if !app.unitDying(unit) {
+				result[unit.Machine]++
+			}
+		}
+	}
+	return result
+}
+
+// unitSatisfiesPlacement reports whether the unit is deployed where the
+// placement directive asks for. Bundle machines are resolved through the
+// machine map.
+func (m *Model) unitSatisfiesPlacement(unit Unit, placement *charm.UnitPlacement) bool {
+	var machine string
+	switch {
+	case placement.Machine == "new":
+		return false
+	case placement.Machine != "":
+		machine = placement.Machine
+		if mappedMachine, ok := m.MachineMap[machine]; ok {
+			machine = mappedMachine
+		}
+	case placement.Application != "" && placement.Unit >= 0:
+		machine = m.getUnitMachine(placement.Application, placement.Unit)
+	case placement.Application != "":
+		app := m.GetApplication(placement.Application)
+		if app == nil {
+			return false
+		}
+		for _, other := range app.Units {
+			if unitOnMachine(unit.Machine, topLevelMachine(other.Machine), placement.ContainerType) {
+				return true
+			}
+		}
+		return false
+	}
+	return machine != "" && unitOnMachine(unit.Machine, machine, placement.ContainerType)
+}
+
+// unitMatchesPlacement is like unitSatisfiesPlacement, but it also accepts
+// any machine, or any container of the requested type, for a new machine
+// placement.
+func (m *Model) unitMatchesPlacement(unit Unit, placement *charm.UnitPlacement) bool {
+	if placement.Machine != "new" {
+		return m.unitSatisfiesPlacement(unit, placement)
+	}
+	if !names.IsValidMachine(unit.Machine) {
+		return false
+	}
+	return names.NewMachineTag(unit.Machine).ContainerType() == placement.ContainerType
+}
+
+// resolvePlacement returns the placement directive with the bundle machine
+// or unit it refers to replaced by the model machine it resolves to.
+func (m *Model) resolvePlacement(directive string) string {
+	placement, err := charm.ParsePlacement(directive)
+	if err != nil || placement == nil {
+		return directive
+	}
+	var machine string
+	switch {
+	case placement.Machine == "new":
+		return directive
+	case placement.Machine != "":
+		machine = placement.Machine
+		if mappedMachine, ok := m.MachineMap[machine]; ok {
+			machine = mappedMachine
+		}
+	case placement.Unit >= 0:
+		machine = m.getUnitMachine(placement.Application, placement.Unit)
+	}
+	if machine == "" {
+		return directive
+	}
+	if placement.ContainerType != "" {
+		return placement.ContainerType + ":" + machine
+	}
+	return machine
+}
+
+// unitOnMachine reports whether the unit machine is the given machine, or a
+// container of the given type on it if containerType is specified.
+func unitOnMachine(unitMachine, machine, containerType string) bool {
+	// More paranoia, as creating a tag from an invalid id panics.
+	if !names.IsValidMachine(unitMachine) {
+		return false
+	}
+	if containerType == "" {
+		return unitMachine == machine
+	}
+	machineTag := names.NewMachineTag(unitMachine)
+	return machineTag.ContainerType() == containerType && machineTag.Parent().Id() == machine
+}
+
+// unitNumber returns the number of the named unit, or -1 if the name is not
+// a valid unit name.
+func unitNumber(unitName string) int {
+	if !names.IsValidUnit(unitName) {
+		return -1
+	}
+	return names.NewUnitTag(unitName).Number()
+}
+
+// unitCount returns the number of units of the application, not counting
+// the dying units that are to be replaced.
 func (a *Application) unitCount() int {
 	if a == nil {
 		return 0
 	}
-	return len(a.Units)
+	count := 0
+	for _, unit := range a.Units {
+		if !a.unitDying(unit) {
+			count++
+		}
+	}
+	return count
+}
+
+// unitDying reports whether the unit of the application is dying or dead.
+func (a *Application) unitDying(unit Unit) bool {
+	return a.UnitLife[unit.Name].isDying()
+}
+
+// usable returns whether the bundle can change the application. Unknown
+// applications are assumed to be usable.
+func (a *Application) usable() bool {
+	return a == nil || (!a.Life.isDying() && a.Status != "error")
+}
+
+// unitUsable returns whether new units can be colocated with the unit of
+// the application.
+func (a *Application) unitUsable(unit Unit) bool {
+	return !a.unitDying(unit) && a.UnitStatus[unit.Name] != "error"
 }
 
 func (a *Application) changedAnnotations(annotations map[string]string) map[string]string {
@@ -390,6 +756,99 @@ func (a *Application) changedAnnotations(annotations map[string]string) map[stri
 	return changes
 }
 
+// changedStorage returns the storage directives for the stores that the
+// application does not have yet, and the sorted names of the existing
+// stores whose directives differ. Nothing is reported when the storage of
+// the application is not known, as adding storage is not idempotent.
+func (a *Application) changedStorage(storage map[string]string) (map[string]string, []string) {
+	if a == nil || len(a.Storage) == 0 {
+		return nil, nil
+	}
+	added := make(map[string]string)
+	var changed []string
+	for name, directive := range storage {
+		current, found := a.Storage[name]
+		switch {
+		case !found:
+			added[name] = directive
+		case current != directive:
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return added, changed
+}
+
+// changedTrust reports whether the trust of the application differs from
+// the given one. Nothing is reported when the trust of the application is
+// not known.
+func (a *Application) changedTrust(trust bool) bool {
+	return a != nil && a.Trust != nil && *a.Trust != trust
+}
+
+// changedBindings returns the endpoint bindings that differ from the ones
+// the application currently has. Nothing is reported when the bindings of
+// the application are not known.
+func (a *Application) changedBindings(bindings map[string]string) map[string]string {
+	if a == nil || len(a.EndpointBindings) == 0 {
+		return nil
+	}
+	changes := make(map[string]string)
+	for endpoint, space := range bindings {
+		current, found := a.EndpointBindings[endpoint]
+		if !found || current != space {
+			changes[endpoint] = space
+		}
+	}
+	return changes
+}
+
+// changedResources returns the resource revisions and local resource paths
+// that differ from the ones the application is using. A nil map is returned
+// when nothing differs, or when the resources of the application are not
+// known.
+func (a *Application) changedResources(resources map[string]int, localResources map[string]string) (map[string]int, map[string]string) {
+	if a == nil || (a.Resources == nil && a.LocalResources == nil) {
+		return nil, nil
+	}
+	var changedResources map[string]int
+	for name, revision := range resources {
+		if current, found := a.Resources[name]; !found || current != revision {
+			if changedResources == nil {
+				changedResources = make(map[string]int)
+			}
+			changedResources[name] = revision
+		}
+	}
+	var changedLocalResources map[string]string
+	for name, path := range localResources {
+		if current, found := a.LocalResources[name]; !found || current != path {
+			if changedLocalResources == nil {
+				changedLocalResources = make(map[string]string)
+			}
+			changedLocalResources[name] = path
+		}
+	}
+	return changedResources, changedLocalResources
+}
+
+// changedDevices returns the sorted names of the devices whose constraints
+// in the bundle differ from the ones the application was deployed with.
+// Nothing is reported when the devices of the application are not known.
+func (a *Application) changedDevices(devices map[string]string) []string {
+	if a == nil || len(a.Devices) == 0 {
+		return nil
+	}
+	var changed []string
+	for name, constraints := range devices {
+		if current, found := a.Devices[name]; !found || current != constraints {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
 func (a *Application) changedOptions(options map[string]interface{}) map[string]interface{} {
 	if a == nil || len(a.Options) == 0 {
 		return options
@@ -5,6 +5,7 @@ package bundlechanges
 
 import (
 	"bytes"
+	"encoding/json"
 
 	"github.com/juju/charm/v9"
 	"github.com/juju/loggo"
@@ -12,6 +13,7 @@ import (
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 )
 
 type modelSuite struct{}
@@ -238,6 +240,29 @@ func (*modelSuite) TestUnitMachinesWithoutAppSourceSomeTargetContainer(c *gc.C)
 	c.Check(machines, jc.DeepEquals, []string{"0", "3", "4"})
 }
 
+func (*modelSuite) TestUnitMachinesWithoutAppSkipsUnusableUnits(c *gc.C) {
+	model := &Model{
+		Applications: map[string]*Application{
+			"django": &Application{
+				UnitLife: map[string]Life{
+					"django/1": Dying,
+				},
+				UnitStatus: map[string]string{
+					"django/0": "active",
+					"django/2": "error",
+				},
+				Units: []Unit{
+					{"django/0", "0"},
+					{"django/1", "1"},
+					{"django/2", "2"},
+				},
+			},
+		},
+	}
+	machines := model.unitMachinesWithoutApp("django", "nginx", "")
+	c.Check(machines, jc.DeepEquals, []string{"0"})
+}
+
 func (*modelSuite) TestBundleMachineMapped(c *gc.C) {
 	model := &Model{
 		Applications: map[string]*Application{
@@ -524,6 +549,109 @@ func (s *inferMachineMapSuite) TestBundleMachinesDeterminism(c *gc.C) {
 	}
 }
 
+func snapshotModel() *Model {
+	return &Model{
+		Applications: map[string]*Application{
+			"django": {
+				Name:     "django",
+				Charm:    "cs:django-4",
+				Options:  map[string]interface{}{"debug": "yes"},
+				Exposed:  true,
+				Revision: -1,
+				ExposedEndpoints: map[string]ExposedEndpoint{
+					"website": {ExposeToSpaces: []string{"public"}},
+				},
+				UnitLife: map[string]Life{
+					"django/1": Dying,
+				},
+				Units: []Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "0/lxd/0"},
+				},
+			},
+		},
+		Machines: map[string]*Machine{
+			"0":       {ID: "0", Series: "focal"},
+			"0/lxd/0": {ID: "0/lxd/0", ContainerType: "lxd", ParentID: "0"},
+		},
+		Relations: []Relation{
+			{App1: "django", Endpoint1: "db", App2: "mysql", Endpoint2: "db"},
+		},
+		Sequence:   map[string]int{"application-django": 2, "machine": 1, "machine-0/lxd": 1},
+		MachineMap: map[string]string{"0": "0"},
+		ConstraintsEqual: func(string, string) bool {
+			return true
+		},
+		logger: loggo.GetLogger("bundlechanges"),
+	}
+}
+
+func (*modelSuite) TestMarshalYAML(c *gc.C) {
+	model := snapshotModel()
+	data, err := yaml.Marshal(model)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `
+applications:
+  django:
+    name: django
+    charm: cs:django-4
+    options:
+      debug: "yes"
+    exposed: true
+    exposed_endpoints:
+      website:
+        expose_to_spaces:
+        - public
+    revision: -1
+    unit_life:
+      django/1: dying
+    units:
+    - name: django/0
+      machine: "0"
+    - name: django/1
+      machine: 0/lxd/0
+machines:
+  "0":
+    id: "0"
+    series: focal
+  0/lxd/0:
+    id: 0/lxd/0
+    container_type: lxd
+    parent_id: "0"
+relations:
+- app1: django
+  endpoint1: db
+  app2: mysql
+  endpoint2: db
+sequence:
+  application-django: 2
+  machine: 1
+  machine-0/lxd: 1
+machine_map:
+  "0": "0"
+`[1:])
+
+	var another Model
+	err = yaml.Unmarshal(data, &another)
+	c.Assert(err, jc.ErrorIsNil)
+	model.ConstraintsEqual = nil
+	model.logger = nil
+	c.Check(&another, jc.DeepEquals, model)
+}
+
+func (*modelSuite) TestMarshalJSON(c *gc.C) {
+	model := snapshotModel()
+	data, err := json.Marshal(model)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var another Model
+	err = json.Unmarshal(data, &another)
+	c.Assert(err, jc.ErrorIsNil)
+	model.ConstraintsEqual = nil
+	model.logger = nil
+	c.Check(&another, jc.DeepEquals, model)
+}
+
 type applicationSuite struct{}
 
 var _ = gc.Suite(&applicationSuite{})
@@ -0,0 +1,208 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// UnresolvedPlaceholderError is returned when a change refers to a change
+// with no recorded result, usually because it was not applied yet.
+type UnresolvedPlaceholderError struct {
+	// Change is the id of the change holding the placeholder.
+	Change string
+	// Placeholder is the unresolved placeholder, such as "$deploy-1".
+	Placeholder string
+}
+
+// Error implements error.
+func (err *UnresolvedPlaceholderError) Error() string {
+	return fmt.Sprintf("change %q refers to unresolved placeholder %q", err.Change, err.Placeholder)
+}
+
+// Resolver records the results of the applied changes, and replaces the
+// placeholders referring to them, such as "$addCharm-0" or "$deploy-1", in
+// the params of the changes still to apply. A Resolver is safe for
+// concurrent use.
+type Resolver struct {
+	mu      sync.Mutex
+	results map[string]string
+	// unitMachines holds the machines of the added units, keyed by change
+	// id, for the units and machines placed with them.
+	unitMachines map[string]string
+}
+
+// NewResolver returns a resolver with no recorded results.
+func NewResolver() *Resolver {
+	return &Resolver{
+		results:      make(map[string]string),
+		unitMachines: make(map[string]string),
+	}
+}
+
+// Record records the result of the applied change with the given id: the
+// charm URL, application name or machine id it produced.
+func (r *Resolver) Record(id, result string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[id] = result
+}
+
+// RecordUnit records the name and machine of the unit added by the change
+// with the given id. Placements referring to the change resolve to the
+// machine of the unit.
+func (r *Resolver) RecordUnit(id, unit, machine string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[id] = unit
+	r.unitMachines[id] = machine
+}
+
+// Result returns the result recorded for the change with the given id, and
+// whether there is one.
+func (r *Resolver) Result(id string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result, found := r.results[id]
+	return result, found
+}
+
+// Results returns the recorded results keyed by change id.
+func (r *Resolver) Results() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make(map[string]string, len(r.results))
+	for id, result := range r.results {
+		results[id] = result
+	}
+	return results
+}
+
+// Resolve returns a copy of the change with the placeholders in its params
+// replaced by the recorded results, or an UnresolvedPlaceholderError if a
+// placeholder refers to a change with no result. The change itself is not
+// modified.
+func (r *Resolver) Resolve(change Change) (Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := &resolution{resolver: r, change: change.Id()}
+	// Changes without placeholders, such as the removals, are returned as
+	// they are.
+	var resolved Change = change
+	switch change := change.(type) {
+	case *UpgradeCharmChange:
+		copied := *change
+		res.value(&copied.Params.Charm)
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *AddApplicationChange:
+		copied := *change
+		res.value(&copied.Params.Charm)
+		resolved = &copied
+	case *AddMachineChange:
+		copied := *change
+		res.machine(&copied.Params.ParentId)
+		resolved = &copied
+	case *AddUnitChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		res.machine(&copied.Params.To)
+		resolved = &copied
+	case *AddRelationChange:
+		copied := *change
+		res.value(&copied.Params.Endpoint1)
+		res.value(&copied.Params.Endpoint2)
+		resolved = &copied
+	case *ExposeChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *UnexposeChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *ScaleChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *SetAnnotationsChange:
+		copied := *change
+		res.value(&copied.Params.Id)
+		resolved = &copied
+	case *SetOptionsChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *SetConstraintsChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *AddStorageChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *BindChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *SetTrustChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	case *CreateOfferChange:
+		copied := *change
+		res.value(&copied.Params.Application)
+		resolved = &copied
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	return resolved, nil
+}
+
+// resolution replaces the placeholders of a change, keeping the first
+// error found. It must be used with the resolver lock held.
+type resolution struct {
+	resolver *Resolver
+	change   string
+	err      error
+}
+
+// value resolves the placeholder in the value, if any. Placeholders come
+// alone, as in "$deploy-1", with an endpoint, as in "$deploy-1:db", or with
+// a container type, as in "lxd:$addMachines-2".
+func (res *resolution) value(value *string) {
+	res.resolve(value, false)
+}
+
+// machine resolves a placement, in which placeholders referring to added
+// units stand for the machines of these units.
+func (res *resolution) machine(value *string) {
+	res.resolve(value, true)
+}
+
+func (res *resolution) resolve(value *string, machine bool) {
+	i := strings.Index(*value, "$")
+	if res.err != nil || i == -1 {
+		return
+	}
+	prefix, id, suffix := (*value)[:i], (*value)[i+1:], ""
+	if j := strings.Index(id, ":"); j != -1 {
+		id, suffix = id[:j], id[j:]
+	}
+	result, found := res.resolver.results[id]
+	if unitMachine, isUnit := res.resolver.unitMachines[id]; machine && isUnit {
+		result = unitMachine
+	}
+	if !found {
+		res.err = &UnresolvedPlaceholderError{
+			Change:      res.change,
+			Placeholder: placeholder(id),
+		}
+		return
+	}
+	*value = prefix + result + suffix
+}
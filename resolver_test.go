@@ -0,0 +1,128 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges_test
+
+import (
+	"strings"
+
+	"github.com/juju/charm/v9"
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/bundlechanges/v5"
+)
+
+type resolverSuite struct{}
+
+var _ = gc.Suite(&resolverSuite{})
+
+// changes returns the changes keyed by id.
+func (s *resolverSuite) changes(c *gc.C) map[string]bundlechanges.Change {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        applications:
+            django:
+                charm: cs:django-4
+                num_units: 1
+                to: ["0"]
+            mysql:
+                charm: cs:mysql-58
+                num_units: 1
+                to: ["lxd:django/0"]
+        machines:
+            "0":
+        relations:
+            - - django:db
+              - mysql:db
+        `))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Verify(nil, nil, nil), jc.ErrorIsNil)
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	result := make(map[string]bundlechanges.Change)
+	for _, change := range changes {
+		result[change.Id()] = change
+	}
+	return result
+}
+
+func (s *resolverSuite) TestResolve(c *gc.C) {
+	changes := s.changes(c)
+	r := bundlechanges.NewResolver()
+	r.Record("addCharm-0", "cs:django-4")
+	r.Record("deploy-1", "django")
+	r.Record("deploy-3", "mysql")
+	r.Record("addMachines-4", "5")
+	r.RecordUnit("addUnit-6", "django/2", "5")
+	r.Record("addMachines-8", "5/lxd/1")
+
+	resolved, err := r.Resolve(changes["deploy-1"])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resolved.(*bundlechanges.AddApplicationChange).Params.Charm, gc.Equals, "cs:django-4")
+
+	resolved, err = r.Resolve(changes["addRelation-5"])
+	c.Assert(err, jc.ErrorIsNil)
+	params := resolved.(*bundlechanges.AddRelationChange).Params
+	c.Check(params.Endpoint1, gc.Equals, "django:db")
+	c.Check(params.Endpoint2, gc.Equals, "mysql:db")
+
+	resolved, err = r.Resolve(changes["addUnit-6"])
+	c.Assert(err, jc.ErrorIsNil)
+	unitParams := resolved.(*bundlechanges.AddUnitChange).Params
+	c.Check(unitParams.Application, gc.Equals, "django")
+	c.Check(unitParams.To, gc.Equals, "5")
+
+	// Containers placed with a unit go to the machine of the unit.
+	resolved, err = r.Resolve(changes["addMachines-8"])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resolved.(*bundlechanges.AddMachineChange).Params.ParentId, gc.Equals, "5")
+
+	resolved, err = r.Resolve(changes["addUnit-7"])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resolved.(*bundlechanges.AddUnitChange).Params.To, gc.Equals, "5/lxd/1")
+
+	// The changes of the plan keep their placeholders.
+	c.Check(changes["addUnit-7"].(*bundlechanges.AddUnitChange).Params.To, gc.Equals, "$addMachines-8")
+	c.Check(resolved.Id(), gc.Equals, "addUnit-7")
+	c.Check(resolved.Requires(), jc.DeepEquals, []string{"deploy-3", "addMachines-8"})
+}
+
+func (s *resolverSuite) TestResolveUnresolved(c *gc.C) {
+	changes := s.changes(c)
+	r := bundlechanges.NewResolver()
+	r.Record("deploy-1", "django")
+	resolved, err := r.Resolve(changes["addRelation-5"])
+	c.Assert(err, gc.ErrorMatches, `change "addRelation-5" refers to unresolved placeholder "\$deploy-3"`)
+	c.Assert(err, jc.DeepEquals, &bundlechanges.UnresolvedPlaceholderError{
+		Change:      "addRelation-5",
+		Placeholder: "$deploy-3",
+	})
+	c.Assert(resolved, gc.IsNil)
+}
+
+func (s *resolverSuite) TestResolveWithoutPlaceholders(c *gc.C) {
+	changes := s.changes(c)
+	r := bundlechanges.NewResolver()
+	resolved, err := r.Resolve(changes["addCharm-0"])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resolved, gc.Equals, changes["addCharm-0"])
+}
+
+func (s *resolverSuite) TestResults(c *gc.C) {
+	r := bundlechanges.NewResolver()
+	r.Record("deploy-1", "django")
+	r.RecordUnit("addUnit-2", "django/0", "0")
+	c.Assert(r.Results(), jc.DeepEquals, map[string]string{
+		"deploy-1":  "django",
+		"addUnit-2": "django/0",
+	})
+	result, found := r.Result("addUnit-2")
+	c.Assert(found, jc.IsTrue)
+	c.Assert(result, gc.Equals, "django/0")
+	_, found = r.Result("addCharm-0")
+	c.Assert(found, jc.IsFalse)
+}
@@ -0,0 +1,435 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/naturalsort"
+	"gopkg.in/yaml.v2"
+)
+
+// ModelFromStatus returns the model described by the output of
+// "juju status --format=yaml" or "juju status --format=json" read from r.
+//
+// The applications, units, machines, relations, exposed endpoints, offers
+// and consumed offers of the model are filled in. Application options,
+// constraints and annotations are not part of the status, and are left
+// empty. The Sequence follows the highest unit numbers and machine ids in
+// the status.
+//
+// The status doesn't tell which endpoints of two applications are related
+// together. They are paired by name, then by interface, and an error is
+// returned when several relations between two applications remain
+// ambiguous.
+func ModelFromStatus(r io.Reader) (*Model, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// JSON documents are valid YAML, so both formats are parsed alike.
+	var status formattedStatus
+	if err := yaml.Unmarshal(data, &status); err != nil {
+		return nil, errors.Annotate(err, "cannot parse status")
+	}
+	model := &Model{
+		Applications: make(map[string]*Application),
+		Machines:     make(map[string]*Machine),
+	}
+	for id, machine := range status.Machines {
+		addStatusMachine(model, id, "", machine)
+	}
+	for name, app := range status.Applications {
+		application, err := statusApplication(name, app)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		model.Applications[name] = application
+	}
+	// Subordinate units are listed with their principals.
+	for _, app := range status.Applications {
+		for _, unit := range app.Units {
+			for unitName, subordinate := range unit.Subordinates {
+				appName := strings.Split(unitName, "/")[0]
+				if application := model.Applications[appName]; application != nil {
+					addStatusUnit(application, unitName, unit.Machine, subordinate)
+				}
+			}
+		}
+	}
+	for _, application := range model.Applications {
+		sortUnits(application.Units)
+	}
+	offerNames := make([]string, 0, len(status.Offers))
+	for name := range status.Offers {
+		offerNames = append(offerNames, name)
+	}
+	for _, name := range naturalsort.Sort(offerNames) {
+		offer := status.Offers[name]
+		application := model.Applications[offer.Application]
+		if application == nil {
+			return nil, errors.Errorf("offer %q of unknown application %q", name, offer.Application)
+		}
+		var endpoints []string
+		for endpoint := range offer.Endpoints {
+			endpoints = append(endpoints, endpoint)
+		}
+		sort.Strings(endpoints)
+		application.Offers = append(application.Offers, name)
+		if application.OfferEndpoints == nil {
+			application.OfferEndpoints = make(map[string][]string)
+		}
+		application.OfferEndpoints[name] = endpoints
+	}
+	// The status lists all the consumed offers, so the remote applications
+	// are known even when there are none.
+	model.RemoteApplications = make(map[string]*RemoteApplication)
+	for name, remote := range status.RemoteApplications {
+		model.RemoteApplications[name] = &RemoteApplication{
+			Name:     name,
+			OfferURL: remote.URL,
+		}
+	}
+	if model.Relations, err = status.relations(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	model.Sequence = model.inferSequence()
+	return model, nil
+}
+
+// formattedStatus holds the parts of the juju status output used to build
+// a model.
+type formattedStatus struct {
+	Machines           map[string]machineStatus           `yaml:"machines"`
+	Applications       map[string]applicationStatus       `yaml:"applications"`
+	RemoteApplications map[string]remoteApplicationStatus `yaml:"application-endpoints"`
+	Offers             map[string]offerStatus             `yaml:"offers"`
+}
+
+type statusInfo struct {
+	Current string `yaml:"current"`
+	Life    string `yaml:"life"`
+}
+
+type machineStatus struct {
+	JujuStatus  statusInfo               `yaml:"juju-status"`
+	Series      string                   `yaml:"series"`
+	Constraints string                   `yaml:"constraints"`
+	Containers  map[string]machineStatus `yaml:"containers"`
+}
+
+type applicationStatus struct {
+	Charm             string                     `yaml:"charm"`
+	CharmOrigin       string                     `yaml:"charm-origin"`
+	CharmName         string                     `yaml:"charm-name"`
+	CharmRev          *int                       `yaml:"charm-rev"`
+	CharmChannel      string                     `yaml:"charm-channel"`
+	Series            string                     `yaml:"series"`
+	Exposed           bool                       `yaml:"exposed"`
+	ExposedEndpoints  map[string]exposedEndpoint `yaml:"exposed-endpoints"`
+	Life              string                     `yaml:"life"`
+	ApplicationStatus statusInfo                 `yaml:"application-status"`
+	Relations         map[string][]interface{}   `yaml:"relations"`
+	SubordinateTo     []string                   `yaml:"subordinate-to"`
+	Units             map[string]unitStatus      `yaml:"units"`
+	Scale             int                        `yaml:"scale"`
+	EndpointBindings  map[string]string          `yaml:"endpoint-bindings"`
+}
+
+type exposedEndpoint struct {
+	ExposeToSpaces []string `yaml:"expose-to-spaces"`
+	ExposeToCIDRs  []string `yaml:"expose-to-cidrs"`
+}
+
+type unitStatus struct {
+	WorkloadStatus statusInfo            `yaml:"workload-status"`
+	JujuStatus     statusInfo            `yaml:"juju-status"`
+	Machine        string                `yaml:"machine"`
+	Subordinates   map[string]unitStatus `yaml:"subordinates"`
+}
+
+type remoteApplicationStatus struct {
+	URL       string                   `yaml:"url"`
+	Relations map[string][]interface{} `yaml:"relations"`
+}
+
+type offerStatus struct {
+	Application string                 `yaml:"application"`
+	Endpoints   map[string]interface{} `yaml:"endpoints"`
+}
+
+func addStatusMachine(model *Model, id, parentID string, status machineStatus) {
+	machine := &Machine{
+		ID:          id,
+		Series:      status.Series,
+		Constraints: status.Constraints,
+		ParentID:    parentID,
+		Life:        Life(status.JujuStatus.Life),
+		Status:      status.JujuStatus.Current,
+	}
+	if parentID != "" {
+		// Container ids are of the form "0/lxd/1".
+		machine.ContainerType = strings.Split(strings.TrimPrefix(id, parentID+"/"), "/")[0]
+	}
+	model.Machines[id] = machine
+	for containerID, container := range status.Containers {
+		addStatusMachine(model, containerID, id, container)
+	}
+}
+
+func statusApplication(name string, status applicationStatus) (*Application, error) {
+	charmURL, err := status.charmURL()
+	if err != nil {
+		return nil, errors.Annotatef(err, "application %q", name)
+	}
+	application := &Application{
+		Name:             name,
+		Charm:            charmURL,
+		Scale:            status.Scale,
+		Exposed:          status.Exposed,
+		SubordinateTo:    status.SubordinateTo,
+		Series:           status.Series,
+		Channel:          status.CharmChannel,
+		Revision:         -1,
+		Life:             Life(status.Life),
+		Status:           status.ApplicationStatus.Current,
+		EndpointBindings: status.EndpointBindings,
+	}
+	if status.CharmRev != nil {
+		application.Revision = *status.CharmRev
+	}
+	if len(status.ExposedEndpoints) != 0 {
+		application.ExposedEndpoints = make(map[string]ExposedEndpoint)
+		for endpoint, exposed := range status.ExposedEndpoints {
+			application.ExposedEndpoints[endpoint] = ExposedEndpoint{
+				ExposeToSpaces: exposed.ExposeToSpaces,
+				ExposeToCIDRs:  exposed.ExposeToCIDRs,
+			}
+		}
+	}
+	for unitName, unit := range status.Units {
+		addStatusUnit(application, unitName, unit.Machine, unit)
+	}
+	return application, nil
+}
+
+// sortUnits sorts the units naturally by name.
+func sortUnits(units []Unit) {
+	byName := make(map[string]Unit, len(units))
+	unitNames := make([]string, len(units))
+	for i, unit := range units {
+		byName[unit.Name] = unit
+		unitNames[i] = unit.Name
+	}
+	for i, name := range naturalsort.Sort(unitNames) {
+		units[i] = byName[name]
+	}
+}
+
+// addStatusUnit adds the unit to the application, with its life and status.
+func addStatusUnit(application *Application, name, machine string, status unitStatus) {
+	application.Units = append(application.Units, Unit{
+		Name:    name,
+		Machine: machine,
+	})
+	if life := Life(status.JujuStatus.Life); life != "" {
+		if application.UnitLife == nil {
+			application.UnitLife = make(map[string]Life)
+		}
+		application.UnitLife[name] = life
+	}
+	if current := status.WorkloadStatus.Current; current != "" {
+		if application.UnitStatus == nil {
+			application.UnitStatus = make(map[string]string)
+		}
+		application.UnitStatus[name] = current
+	}
+}
+
+// charmURL returns the charm URL of the application. Older controllers
+// report the URL as the charm, newer ones the name and origin of the charm.
+func (status applicationStatus) charmURL() (string, error) {
+	if strings.Contains(status.Charm, ":") {
+		return status.Charm, nil
+	}
+	name := status.CharmName
+	if name == "" {
+		name = status.Charm
+	}
+	if name == "" {
+		return "", errors.New("no charm")
+	}
+	switch status.CharmOrigin {
+	case "charmhub":
+		return "ch:" + name, nil
+	case "local":
+		return fmt.Sprintf("local:%s%s", name, status.revisionSuffix()), nil
+	case "", "charmstore", "jujucharms":
+		return fmt.Sprintf("cs:%s%s", name, status.revisionSuffix()), nil
+	}
+	return "", errors.NotSupportedf("charm origin %q", status.CharmOrigin)
+}
+
+func (status applicationStatus) revisionSuffix() string {
+	if status.CharmRev == nil {
+		return ""
+	}
+	return fmt.Sprintf("-%d", *status.CharmRev)
+}
+
+// relatedApplication returns the application name of an entry of the
+// relations of an application in the status, which is either the name
+// itself or a map holding it as "related-application", and the interface of
+// the relation when the entry provides it.
+func relatedApplication(entry interface{}) (string, string) {
+	switch entry := entry.(type) {
+	case string:
+		return entry, ""
+	case map[interface{}]interface{}:
+		name, _ := entry["related-application"].(string)
+		iface, _ := entry["interface"].(string)
+		return name, iface
+	}
+	return "", ""
+}
+
+// relationEnd is an endpoint of an application related to another
+// application in the status.
+type relationEnd struct {
+	app      string
+	endpoint string
+	iface    string
+	other    string
+}
+
+// relations returns the relations between the applications of the status.
+// The status lists the related applications for each endpoint, but not the
+// endpoints they are related with, so each endpoint is paired with an
+// endpoint of the related application that lists the application in turn:
+// the endpoint with the same name, or else the only one with the same
+// interface, or else the only one left. An error is returned when the
+// endpoints of two applications can't be paired that way. Peer relations
+// are not returned.
+func (status formattedStatus) relations() ([]Relation, error) {
+	endpoints := make(map[string]map[string][]interface{})
+	for name, app := range status.Applications {
+		endpoints[name] = app.Relations
+	}
+	for name, remote := range status.RemoteApplications {
+		endpoints[name] = remote.Relations
+	}
+	var ends []relationEnd
+	appNames := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		appNames = append(appNames, name)
+	}
+	for _, name := range naturalsort.Sort(appNames) {
+		endpointNames := make([]string, 0, len(endpoints[name]))
+		for endpoint := range endpoints[name] {
+			endpointNames = append(endpointNames, endpoint)
+		}
+		sort.Strings(endpointNames)
+		for _, endpoint := range endpointNames {
+			for _, entry := range endpoints[name][endpoint] {
+				if other, iface := relatedApplication(entry); other != "" && other != name {
+					ends = append(ends, relationEnd{app: name, endpoint: endpoint, iface: iface, other: other})
+				}
+			}
+		}
+	}
+
+	// The ends of the relations between two applications are paired
+	// together, those of the application coming first being on the left.
+	partner := make(map[int]int)
+	done := make(map[[2]string]bool)
+	for _, end := range ends {
+		key := [2]string{end.app, end.other}
+		if done[key] {
+			continue
+		}
+		done[key], done[[2]string{end.other, end.app}] = true, true
+		var left, right []int
+		for i, other := range ends {
+			switch {
+			case other.app == end.app && other.other == end.other:
+				left = append(left, i)
+			case other.app == end.other && other.other == end.app:
+				right = append(right, i)
+			}
+		}
+		if err := pairRelationEnds(ends, left, right, partner); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var relations []Relation
+	for i, end := range ends {
+		j, found := partner[i]
+		if !found || j < i {
+			continue
+		}
+		relations = append(relations, Relation{
+			App1:      end.app,
+			Endpoint1: end.endpoint,
+			App2:      ends[j].app,
+			Endpoint2: ends[j].endpoint,
+		})
+	}
+	return relations, nil
+}
+
+// pairRelationEnds records the partners of the given left and right ends of
+// the relations between two applications.
+func pairRelationEnds(ends []relationEnd, left, right []int, partner map[int]int) error {
+	pair := func(i, j int) {
+		partner[i], partner[j] = j, i
+	}
+	unpaired := func(indexes []int) []int {
+		var result []int
+		for _, i := range indexes {
+			if _, found := partner[i]; !found {
+				result = append(result, i)
+			}
+		}
+		return result
+	}
+	// Endpoints with the same name go together.
+	for _, i := range left {
+		for _, j := range unpaired(right) {
+			if ends[i].endpoint == ends[j].endpoint {
+				pair(i, j)
+				break
+			}
+		}
+	}
+	// Then endpoints with the only matching interface.
+	for _, i := range unpaired(left) {
+		if ends[i].iface == "" {
+			continue
+		}
+		var candidates []int
+		for _, j := range unpaired(right) {
+			if ends[j].iface == ends[i].iface {
+				candidates = append(candidates, j)
+			}
+		}
+		if len(candidates) == 1 {
+			pair(i, candidates[0])
+		}
+	}
+	left, right = unpaired(left), unpaired(right)
+	switch {
+	case len(left) == 1 && len(right) == 1:
+		pair(left[0], right[0])
+	case len(left) > 0 && len(right) > 0:
+		first, second := ends[left[0]], ends[right[0]]
+		return errors.Errorf("cannot tell which endpoints of %s and %s are related", first.app, second.app)
+	}
+	return nil
+}
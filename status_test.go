@@ -0,0 +1,315 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/bundlechanges/v5"
+)
+
+type statusSuite struct{}
+
+var _ = gc.Suite(&statusSuite{})
+
+const yamlStatus = `
+model:
+  name: default
+  type: iaas
+machines:
+  "0":
+    juju-status:
+      current: started
+    series: focal
+    constraints: mem=4G
+    containers:
+      0/lxd/0:
+        juju-status:
+          current: started
+        series: focal
+  "2":
+    juju-status:
+      current: down
+      life: dying
+    series: focal
+applications:
+  django:
+    charm: django
+    charm-origin: charmstore
+    charm-name: django
+    charm-rev: 4
+    charm-channel: stable
+    series: focal
+    exposed: true
+    exposed-endpoints:
+      website:
+        expose-to-spaces: [public]
+    application-status:
+      current: active
+    relations:
+      db:
+      - mysql
+      juju-info:
+      - ntp
+    units:
+      django/0:
+        workload-status:
+          current: active
+        juju-status:
+          current: idle
+        machine: "0"
+        subordinates:
+          ntp/0:
+            workload-status:
+              current: active
+            juju-status:
+              current: idle
+      django/1:
+        workload-status:
+          current: error
+        juju-status:
+          current: idle
+          life: dying
+        machine: 0/lxd/0
+    endpoint-bindings:
+      "": alpha
+  ntp:
+    charm: ntp
+    charm-origin: charmhub
+    charm-name: ntp
+    charm-rev: 12
+    charm-channel: latest/stable
+    series: focal
+    application-status:
+      current: active
+    relations:
+      juju-info:
+      - related-application: django
+        interface: juju-info
+        scope: container
+    subordinate-to: [django]
+  mysql:
+    charm: cs:mysql-58
+    series: focal
+    application-status:
+      current: active
+    relations:
+      cluster:
+      - mysql
+      db:
+      - django
+    units:
+      mysql/3:
+        workload-status:
+          current: active
+        juju-status:
+          current: idle
+        machine: "2"
+application-endpoints:
+  logs:
+    url: admin/other.logs
+offers:
+  db:
+    application: mysql
+    charm: cs:mysql-58
+    endpoints:
+      db:
+        interface: mysql
+        role: provider
+`
+
+func (s *statusSuite) TestModelFromYAMLStatus(c *gc.C) {
+	model, err := bundlechanges.ModelFromStatus(strings.NewReader(yamlStatus))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(model, jc.DeepEquals, &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Name:     "django",
+				Charm:    "cs:django-4",
+				Exposed:  true,
+				Series:   "focal",
+				Channel:  "stable",
+				Revision: 4,
+				Status:   "active",
+				ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+					"website": {ExposeToSpaces: []string{"public"}},
+				},
+				EndpointBindings: map[string]string{"": "alpha"},
+				UnitLife: map[string]bundlechanges.Life{
+					"django/1": bundlechanges.Dying,
+				},
+				UnitStatus: map[string]string{
+					"django/0": "active",
+					"django/1": "error",
+				},
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+					{Name: "django/1", Machine: "0/lxd/0"},
+				},
+			},
+			"ntp": {
+				Name:          "ntp",
+				Charm:         "ch:ntp",
+				SubordinateTo: []string{"django"},
+				Series:        "focal",
+				Channel:       "latest/stable",
+				Revision:      12,
+				Status:        "active",
+				UnitStatus:    map[string]string{"ntp/0": "active"},
+				Units: []bundlechanges.Unit{
+					{Name: "ntp/0", Machine: "0"},
+				},
+			},
+			"mysql": {
+				Name:           "mysql",
+				Charm:          "cs:mysql-58",
+				Series:         "focal",
+				Revision:       -1,
+				Status:         "active",
+				Offers:         []string{"db"},
+				OfferEndpoints: map[string][]string{"db": {"db"}},
+				UnitStatus:     map[string]string{"mysql/3": "active"},
+				Units: []bundlechanges.Unit{
+					{Name: "mysql/3", Machine: "2"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0", Series: "focal", Constraints: "mem=4G", Status: "started"},
+			"0/lxd/0": {
+				ID:            "0/lxd/0",
+				Series:        "focal",
+				ContainerType: "lxd",
+				ParentID:      "0",
+				Status:        "started",
+			},
+			"2": {ID: "2", Series: "focal", Life: bundlechanges.Dying, Status: "down"},
+		},
+		Relations: []bundlechanges.Relation{
+			{App1: "django", Endpoint1: "db", App2: "mysql", Endpoint2: "db"},
+			{App1: "django", Endpoint1: "juju-info", App2: "ntp", Endpoint2: "juju-info"},
+		},
+		RemoteApplications: map[string]*bundlechanges.RemoteApplication{
+			"logs": {Name: "logs", OfferURL: "admin/other.logs"},
+		},
+		Sequence: map[string]int{
+			"application-django": 2,
+			"application-ntp":    1,
+			"application-mysql":  4,
+			"machine":            3,
+			"machine-0/lxd":      1,
+		},
+	})
+}
+
+func (s *statusSuite) TestModelFromJSONStatus(c *gc.C) {
+	model, err := bundlechanges.ModelFromStatus(strings.NewReader(`{
+		"machines": {"0": {"juju-status": {"current": "started"}, "series": "focal"}},
+		"applications": {
+			"django": {
+				"charm": "cs:django-4",
+				"series": "focal",
+				"exposed": false,
+				"units": {"django/0": {"machine": "0"}}
+			}
+		}
+	}`))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(model, jc.DeepEquals, &bundlechanges.Model{
+		Applications: map[string]*bundlechanges.Application{
+			"django": {
+				Name:     "django",
+				Charm:    "cs:django-4",
+				Series:   "focal",
+				Revision: -1,
+				Units: []bundlechanges.Unit{
+					{Name: "django/0", Machine: "0"},
+				},
+			},
+		},
+		Machines: map[string]*bundlechanges.Machine{
+			"0": {ID: "0", Series: "focal", Status: "started"},
+		},
+		RemoteApplications: map[string]*bundlechanges.RemoteApplication{},
+		Sequence: map[string]int{
+			"application-django": 1,
+			"machine":            1,
+		},
+	})
+}
+
+func (s *statusSuite) TestModelFromStatusRelations(c *gc.C) {
+	model, err := bundlechanges.ModelFromStatus(strings.NewReader(`
+applications:
+  ceph-mon:
+    charm: cs:ceph-mon-55
+    relations:
+      admin:
+      - related-application: ceph-osd
+        interface: ceph-admin
+      client:
+      - ceph-osd
+      osd:
+      - related-application: ceph-osd
+        interface: ceph-osd
+  ceph-osd:
+    charm: cs:ceph-osd-310
+    relations:
+      client:
+      - ceph-mon
+      mon:
+      - related-application: ceph-mon
+        interface: ceph-osd
+      secrets:
+      - related-application: ceph-mon
+        interface: ceph-admin
+`))
+	c.Assert(err, jc.ErrorIsNil)
+	// Endpoints with the same name are paired first, then endpoints with
+	// the same interface.
+	c.Check(model.Relations, jc.DeepEquals, []bundlechanges.Relation{
+		{App1: "ceph-mon", Endpoint1: "admin", App2: "ceph-osd", Endpoint2: "secrets"},
+		{App1: "ceph-mon", Endpoint1: "client", App2: "ceph-osd", Endpoint2: "client"},
+		{App1: "ceph-mon", Endpoint1: "osd", App2: "ceph-osd", Endpoint2: "mon"},
+	})
+}
+
+func (s *statusSuite) TestModelFromStatusAmbiguousRelations(c *gc.C) {
+	_, err := bundlechanges.ModelFromStatus(strings.NewReader(`
+applications:
+  ceph-mon:
+    charm: cs:ceph-mon-55
+    relations:
+      admin:
+      - ceph-osd
+      osd:
+      - ceph-osd
+  ceph-osd:
+    charm: cs:ceph-osd-310
+    relations:
+      mon:
+      - ceph-mon
+      secrets:
+      - ceph-mon
+`))
+	c.Assert(err, gc.ErrorMatches, `cannot tell which endpoints of ceph-mon and ceph-osd are related`)
+}
+
+func (s *statusSuite) TestModelFromStatusUnknownOrigin(c *gc.C) {
+	_, err := bundlechanges.ModelFromStatus(strings.NewReader(`
+applications:
+  django:
+    charm: django
+    charm-origin: elsewhere
+`))
+	c.Assert(err, gc.ErrorMatches, `application "django": charm origin "elsewhere" not supported`)
+}
+
+func (s *statusSuite) TestModelFromInvalidStatus(c *gc.C) {
+	_, err := bundlechanges.ModelFromStatus(strings.NewReader("machines: [}"))
+	c.Assert(err, gc.ErrorMatches, `cannot parse status: .*`)
+}
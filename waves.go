@@ -0,0 +1,61 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges
+
+import (
+	"github.com/juju/errors"
+)
+
+// Waves partitions the given changes into waves, so that the changes of a
+// wave only require changes of the previous waves and can be applied in
+// parallel once those are applied. Each change goes in the earliest wave
+// possible, and the changes of a wave keep their order in the plan. Only
+// the requirements of the changes order them across waves: the changes to
+// an existing application require its charm upgrade, and unexposing its
+// endpoints requires exposing the new ones.
+//
+// The limits hold the maximum number of changes of a wave keyed by change
+// method, such as "addUnit". The changes beyond the limit of a wave are
+// moved to the following waves. Methods not listed are not limited.
+func Waves(changes []Change, limits map[string]int) ([][]Change, error) {
+	for method, limit := range limits {
+		if limit < 1 {
+			return nil, errors.NotValidf("limit %d for method %q", limit, method)
+		}
+	}
+	sorted, err := (&changeset{changes: changes}).sorted()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	waveOf := make(map[string]int, len(sorted))
+	// counts holds the number of changes in each wave by method, for the
+	// limited methods.
+	counts := make(map[string][]int)
+	var waves [][]Change
+	for _, change := range sorted {
+		wave := 0
+		for _, r := range change.Requires() {
+			if w := waveOf[r] + 1; w > wave {
+				wave = w
+			}
+		}
+		if limit, found := limits[change.Method()]; found {
+			count := counts[change.Method()]
+			for wave < len(count) && count[wave] >= limit {
+				wave++
+			}
+			for len(count) <= wave {
+				count = append(count, 0)
+			}
+			count[wave]++
+			counts[change.Method()] = count
+		}
+		for len(waves) <= wave {
+			waves = append(waves, nil)
+		}
+		waves[wave] = append(waves[wave], change)
+		waveOf[change.Id()] = wave
+	}
+	return waves, nil
+}
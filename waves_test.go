@@ -0,0 +1,154 @@
+// Copyright 2021 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bundlechanges_test
+
+import (
+	"strings"
+
+	"github.com/juju/charm/v9"
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/bundlechanges/v5"
+)
+
+type wavesSuite struct{}
+
+var _ = gc.Suite(&wavesSuite{})
+
+func (s *wavesSuite) changes(c *gc.C) []bundlechanges.Change {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        applications:
+            django:
+                charm: cs:django-4
+                num_units: 1
+            haproxy:
+                charm: cs:haproxy-2
+                num_units: 1
+            mysql:
+                charm: cs:mysql-58
+                num_units: 1
+        relations:
+            - - django:db
+              - mysql:db
+            - - haproxy:reverseproxy
+              - django:website
+        `))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Verify(nil, nil, nil), jc.ErrorIsNil)
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Logger: loggo.GetLogger("bundlechanges"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return changes
+}
+
+func waveIds(waves [][]bundlechanges.Change) [][]string {
+	result := make([][]string, len(waves))
+	for i, wave := range waves {
+		for _, change := range wave {
+			result[i] = append(result[i], change.Id())
+		}
+	}
+	return result
+}
+
+func (s *wavesSuite) TestWaves(c *gc.C) {
+	waves, err := bundlechanges.Waves(s.changes(c), nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(waveIds(waves), jc.DeepEquals, [][]string{
+		{"addCharm-0", "addCharm-2", "addCharm-4"},
+		{"deploy-1", "deploy-3", "deploy-5"},
+		{"addRelation-6", "addRelation-7", "addUnit-8", "addUnit-9", "addUnit-10"},
+	})
+}
+
+func (s *wavesSuite) TestWavesWithLimits(c *gc.C) {
+	waves, err := bundlechanges.Waves(s.changes(c), map[string]int{
+		"addUnit": 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(waveIds(waves), jc.DeepEquals, [][]string{
+		{"addCharm-0", "addCharm-2", "addCharm-4"},
+		{"deploy-1", "deploy-3", "deploy-5"},
+		{"addRelation-6", "addRelation-7", "addUnit-8"},
+		{"addUnit-9"},
+		{"addUnit-10"},
+	})
+}
+
+func (s *wavesSuite) TestWavesLimitsDelayDependents(c *gc.C) {
+	waves, err := bundlechanges.Waves(s.changes(c), map[string]int{
+		"addCharm": 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(waveIds(waves), jc.DeepEquals, [][]string{
+		{"addCharm-0"},
+		{"deploy-1", "addCharm-2"},
+		{"deploy-3", "addCharm-4", "addUnit-8"},
+		{"deploy-5", "addRelation-7", "addUnit-9"},
+		{"addRelation-6", "addUnit-10"},
+	})
+}
+
+func (s *wavesSuite) TestWavesInvalidLimit(c *gc.C) {
+	_, err := bundlechanges.Waves(s.changes(c), map[string]int{
+		"addUnit": 0,
+	})
+	c.Assert(err, gc.ErrorMatches, `limit 0 for method "addUnit" not valid`)
+}
+
+func (s *wavesSuite) TestWavesUpgradeExistingApplication(c *gc.C) {
+	data, err := charm.ReadBundleData(strings.NewReader(`
+        applications:
+            django:
+                charm: cs:django-5
+                trust: true
+                options:
+                    debug: true
+                storage:
+                    data: ebs,10G
+                    logs: ebs,1G
+                bindings:
+                    "": beta
+                exposed-endpoints:
+                    website:
+                        expose-to-cidrs: [0.0.0.0/0]
+        `))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(data.Verify(nil, nil, nil), jc.ErrorIsNil)
+	untrusted := false
+	changes, err := bundlechanges.FromData(bundlechanges.ChangesConfig{
+		Bundle: data,
+		Model: &bundlechanges.Model{
+			Applications: map[string]*bundlechanges.Application{
+				"django": {
+					Charm:            "cs:django-4",
+					Trust:            &untrusted,
+					Storage:          map[string]string{"data": "ebs,10G"},
+					EndpointBindings: map[string]string{"": "alpha"},
+					Exposed:          true,
+					ExposedEndpoints: map[string]bundlechanges.ExposedEndpoint{
+						"admin": {ExposeToCIDRs: []string{"0.0.0.0/0"}},
+					},
+				},
+			},
+		},
+		Logger: loggo.GetLogger("bundlechanges"),
+		Prune:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	waves, err := bundlechanges.Waves(changes, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	// The changes to the application wait for its charm to be upgraded,
+	// and the endpoints are unexposed once the new ones are exposed.
+	c.Assert(waveIds(waves), jc.DeepEquals, [][]string{
+		{"addCharm-0"},
+		{"upgradeCharm-1"},
+		{"setOptions-2", "addStorage-3", "setTrust-4", "bind-5", "expose-6"},
+		{"unexpose-7"},
+	})
+}